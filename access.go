@@ -0,0 +1,290 @@
+package ponder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Access is a parsed ACCESS value granting a user read access to a set of
+// sections. ACCESS keys are user emails, key fingerprints, age or SSH
+// public keys, or @name to grant every member of the group name listed in
+// the GROUPS section. A value is a list of terms separated by commas or
+// whitespace:
+//
+//	myhost     myhost and its subsections (myhost.prod, ...)
+//	prod.*     the subsections of prod, but not prod itself
+//	!billing   not billing, nor its subsections
+//
+// The term * grants every section. Negations take precedence over every
+// other term. A list made only of negations starts from every section, so
+// "!billing" grants everything except billing.
+type Access struct {
+	allow []string
+	deny  []string
+}
+
+// AccessError reports an invalid ACCESS entry.
+type AccessError struct {
+	Line int    // line of the entry in the edited text, 0 if unknown
+	User string // the entry's key
+	Term string // the offending term, if any
+	Msg  string
+}
+
+func (e *AccessError) Error() string {
+	msg := e.Msg
+	if e.Term != "" {
+		msg = fmt.Sprintf("%q: %s", e.Term, e.Msg)
+	}
+	if e.User != "" {
+		msg = e.User + ": " + msg
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("ACCESS line %d: %s", e.Line, msg)
+	}
+	return "ACCESS: " + msg
+}
+
+// ParseAccess parses an ACCESS value.
+func ParseAccess(value string) (*Access, error) {
+	terms := splitList(value)
+	if len(terms) == 0 {
+		return nil, &AccessError{Msg: "no sections listed"}
+	}
+
+	a := &Access{}
+	for _, term := range terms {
+		pattern := strings.TrimPrefix(term, "!")
+		if err := checkPattern(pattern); err != "" {
+			return nil, &AccessError{Term: term, Msg: err}
+		}
+		if pattern != term {
+			if pattern == "*" {
+				return nil, &AccessError{Term: term, Msg: "negating * grants nothing"}
+			}
+			a.deny = append(a.deny, pattern)
+		} else {
+			a.allow = append(a.allow, pattern)
+		}
+	}
+	if len(a.allow) == 0 {
+		a.allow = []string{"*"}
+	}
+	return a, nil
+}
+
+func checkPattern(pattern string) string {
+	switch {
+	case pattern == "":
+		return "empty section name"
+	case pattern == "*":
+		return ""
+	case strings.ContainsAny(pattern, "[]=!"):
+		return "invalid character in section name"
+	case strings.HasPrefix(pattern, "."):
+		return "section name starts with a dot"
+	case strings.HasSuffix(pattern, "."):
+		return "section name ends with a dot"
+	}
+	if i := strings.Index(pattern, "*"); i >= 0 && (i != len(pattern)-1 || !strings.HasSuffix(pattern, ".*")) {
+		return "only a trailing .* is allowed as a wildcard"
+	}
+	return ""
+}
+
+// All reports whether a grants access to every section.
+func (a *Access) All() bool {
+	return len(a.deny) == 0 && inSlice("*", a.allow)
+}
+
+// Allows reports whether a grants access to section.
+func (a *Access) Allows(section string) bool {
+	for _, pattern := range a.deny {
+		if matchSection(pattern, section) {
+			return false
+		}
+	}
+	for _, pattern := range a.allow {
+		if matchSection(pattern, section) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSection(pattern, section string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, ".*"):
+		return strings.HasPrefix(section, strings.TrimSuffix(pattern, "*"))
+	}
+	return section == pattern || strings.HasPrefix(section, pattern+".")
+}
+
+// accessList is the union of the ACCESS entries that apply to one user,
+// directly or through groups.
+type accessList []*Access
+
+func (l accessList) All() bool {
+	for _, a := range l {
+		if a.All() {
+			return true
+		}
+	}
+	return false
+}
+
+func (l accessList) Allows(section string) bool {
+	for _, a := range l {
+		if a.Allows(section) {
+			return true
+		}
+	}
+	return false
+}
+
+// grant is the access a single user has been given.
+type grant struct {
+	user    string
+	access  accessList
+	entries []string // the ACCESS keys the access came from
+}
+
+// grants parses every entry of the ACCESS section, expanding @group
+// entries to one grant per member. Users named more than once, directly or
+// through groups, get the union of their entries.
+func (v *Vault) grants() ([]grant, error) {
+	sec, err := v.cfg.GetSection("ACCESS")
+	if err != nil {
+		return nil, ErrNoAccess
+	}
+
+	var grants []grant
+	index := make(map[string]int)
+	for _, k := range sec.Keys() {
+		a, err := ParseAccess(k.Value())
+		if err != nil {
+			aerr := err.(*AccessError)
+			aerr.User = k.Name()
+			aerr.Line = v.lines["ACCESS"][k.Name()]
+			return nil, aerr
+		}
+
+		users := []string{k.Name()}
+		if isGroup(k.Name()) {
+			users, err = v.members(k.Name())
+			if err != nil {
+				return nil, &AccessError{Line: v.lines["ACCESS"][k.Name()], User: k.Name(), Msg: err.Error()}
+			}
+		}
+
+		for _, user := range users {
+			i, ok := index[user]
+			if !ok {
+				i = len(grants)
+				index[user] = i
+				grants = append(grants, grant{user: user})
+			}
+			grants[i].access = append(grants[i].access, a)
+			grants[i].entries = append(grants[i].entries, k.Name())
+		}
+	}
+	return grants, nil
+}
+
+func isGroup(name string) bool {
+	return strings.HasPrefix(name, "@")
+}
+
+// members returns the users in group, following nested groups.
+func (v *Vault) members(group string) ([]string, error) {
+	var users []string
+	seen := make(map[string]bool)
+	var walk func(group string) error
+	walk = func(group string) error {
+		if seen[group] {
+			return fmt.Errorf("group %s includes itself", group)
+		}
+		seen[group] = true
+		defer delete(seen, group)
+
+		sec, err := v.cfg.GetSection("GROUPS")
+		if err != nil || !inSlice(strings.TrimPrefix(group, "@"), sec.KeyStrings()) {
+			return fmt.Errorf("unknown group %s", group)
+		}
+		for _, member := range splitMembers(sec.Key(strings.TrimPrefix(group, "@")).Value()) {
+			if isGroup(member) {
+				if err := walk(member); err != nil {
+					return err
+				}
+			} else if !inSlice(member, users) {
+				users = append(users, member)
+			}
+		}
+		return nil
+	}
+	if err := walk(group); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// splitList splits a comma or whitespace separated list.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// splitMembers splits a list of users like splitList, keeping the type
+// and key of an SSH public key together. SSH keys in lists cannot have a
+// comment.
+func splitMembers(value string) []string {
+	var members []string
+	for _, m := range splitList(value) {
+		if n := len(members); n > 0 && isSSHKeyType(members[n-1]) && !strings.Contains(members[n-1], " ") {
+			members[n-1] += " " + m
+			continue
+		}
+		members = append(members, m)
+	}
+	return members
+}
+
+// keyLines maps each section and key in plain to its 1-based line number.
+func keyLines(plain []byte) map[string]map[string]int {
+	lines := make(map[string]map[string]int)
+	section := ini.DEFAULT_SECTION
+	s := bufio.NewScanner(bytes.NewReader(plain))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			section = strings.TrimSpace(strings.Trim(line, "[]"))
+		default:
+			if q := line[:1]; q == "\"" || q == "`" {
+				// Quoted keys, such as SSH keys ending in =, may
+				// contain the delimiter.
+				if i := strings.Index(line[1:], q); i >= 0 {
+					line = line[1:i+1] + "=" + line[i+2:]
+				}
+			}
+			if i := strings.IndexAny(line, "=:"); i > 0 {
+				key := strings.TrimSpace(line[:i])
+				if lines[section] == nil {
+					lines[section] = make(map[string]int)
+				}
+				if _, ok := lines[section][key]; !ok {
+					lines[section][key] = n
+				}
+			}
+		}
+	}
+	return lines
+}
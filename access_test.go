@@ -0,0 +1,160 @@
+package ponder
+
+import (
+	"testing"
+)
+
+func TestParseAccess(t *testing.T) {
+	tests := []struct {
+		value string
+		allow []string
+		deny  []string
+		err   string
+	}{
+		{value: "*", allow: []string{"*"}},
+		{value: "myhost,db", allow: []string{"myhost", "db"}},
+		{value: "myhost, db", allow: []string{"myhost", "db"}},
+		{value: "myhost db\tweb", allow: []string{"myhost", "db", "web"}},
+		{value: "prod.*", allow: []string{"prod.*"}},
+		{value: "*, !billing", allow: []string{"*"}, deny: []string{"billing"}},
+		{value: "!billing", allow: []string{"*"}, deny: []string{"billing"}},
+		{value: "!billing, !hr", allow: []string{"*"}, deny: []string{"billing", "hr"}},
+		{value: "", err: `ACCESS: no sections listed`},
+		{value: " , ", err: `ACCESS: no sections listed`},
+		{value: "prod*", err: `ACCESS: "prod*": only a trailing .* is allowed as a wildcard`},
+		{value: "x.*.y", err: `ACCESS: "x.*.y": only a trailing .* is allowed as a wildcard`},
+		{value: "!*", err: `ACCESS: "!*": negating * grants nothing`},
+		{value: "!", err: `ACCESS: "!": empty section name`},
+		{value: ".prod", err: `ACCESS: ".prod": section name starts with a dot`},
+		{value: "foo.", err: `ACCESS: "foo.": section name ends with a dot`},
+		{value: "a[b]", err: `ACCESS: "a[b]": invalid character in section name`},
+	}
+	for _, tt := range tests {
+		a, err := ParseAccess(tt.value)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("ParseAccess(%q) error = %v, want %s", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseAccess(%q) error = %v", tt.value, err)
+			continue
+		}
+		if !equalStrings(a.allow, tt.allow) || !equalStrings(a.deny, tt.deny) {
+			t.Errorf("ParseAccess(%q) = allow %q deny %q, want allow %q deny %q", tt.value, a.allow, a.deny, tt.allow, tt.deny)
+		}
+	}
+}
+
+func TestAccessAllows(t *testing.T) {
+	tests := []struct {
+		value   string
+		allowed []string
+		denied  []string
+	}{
+		{"*", []string{"myhost", "billing", "prod.web"}, nil},
+		{"myhost,db", []string{"myhost", "myhost.prod", "db"}, []string{"myhostx", "web", "dbx.y"}},
+		{"myhost db", []string{"myhost", "db.replica"}, []string{"web"}},
+		{"prod.*", []string{"prod.web", "prod.db.replica"}, []string{"prod", "production", "staging.web"}},
+		{"*, !billing", []string{"myhost", "billingx"}, []string{"billing", "billing.eu"}},
+		{"!billing", []string{"myhost", "prod.web"}, []string{"billing", "billing.eu"}},
+		{"prod.*, !prod.db", []string{"prod.web"}, []string{"prod", "prod.db", "prod.db.replica"}},
+	}
+	for _, tt := range tests {
+		a, err := ParseAccess(tt.value)
+		if err != nil {
+			t.Fatalf("ParseAccess(%q) error = %v", tt.value, err)
+		}
+		for _, section := range tt.allowed {
+			if !a.Allows(section) {
+				t.Errorf("%q does not allow %q", tt.value, section)
+			}
+		}
+		for _, section := range tt.denied {
+			if a.Allows(section) {
+				t.Errorf("%q allows %q", tt.value, section)
+			}
+		}
+	}
+}
+
+func TestMatchSection(t *testing.T) {
+	tests := []struct {
+		pattern, section string
+		want             bool
+	}{
+		{"*", "anything", true},
+		{"myhost", "myhost", true},
+		{"myhost", "myhost.prod", true},
+		{"myhost", "myhost.prod.eu", true},
+		{"myhost", "myhostx", false},
+		{"myhost", "my", false},
+		{"myhost.prod", "myhost", false},
+		{"prod.*", "prod.web", true},
+		{"prod.*", "prod.web.eu", true},
+		{"prod.*", "prod", false},
+		{"prod.*", "production", false},
+	}
+	for _, tt := range tests {
+		if got := matchSection(tt.pattern, tt.section); got != tt.want {
+			t.Errorf("matchSection(%q, %q) = %t, want %t", tt.pattern, tt.section, got, tt.want)
+		}
+	}
+}
+
+const badAccess = `; team vault
+[ACCESS]
+alice@example.com = *
+bob@example.com   = web, prod*
+
+[web]
+password = s3cret
+`
+
+func TestGrantsErrorLine(t *testing.T) {
+	v, err := Parse(&Config{}, []byte(badAccess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.grants()
+	aerr, ok := err.(*AccessError)
+	if !ok {
+		t.Fatalf("grants() error = %v, want *AccessError", err)
+	}
+	if aerr.Line != 4 || aerr.User != "bob@example.com" || aerr.Term != "prod*" {
+		t.Errorf("grants() error = %+v, want line 4, bob@example.com, prod*", aerr)
+	}
+	if want := `ACCESS line 4: bob@example.com: "prod*": only a trailing .* is allowed as a wildcard`; err.Error() != want {
+		t.Errorf("grants() error = %q, want %q", err, want)
+	}
+}
+
+func TestCheckErrorLine(t *testing.T) {
+	problems, err := Check(&Config{}, []byte(badAccess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 {
+		t.Fatalf("Check() = %v, want one problem", problems)
+	}
+	p := problems[0]
+	if p.Line != 4 || !p.Fatal {
+		t.Errorf("Check() = %+v, want a fatal problem on line 4", p)
+	}
+	if want := `line 4: ACCESS: bob@example.com: "prod*": only a trailing .* is allowed as a wildcard`; p.String() != want {
+		t.Errorf("Check() = %q, want %q", p, want)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+package ponder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+// ageExt is the extension of vault files encrypted with age, binary or
+// ASCII armored. Users without an OpenPGP key can be granted access with
+// an age public key, age1..., or an SSH public key, ssh-ed25519 ... or
+// ssh-rsa ..., as their ACCESS entry. Their copy of the vault is encrypted
+// with age, still holding a message signed by the writer's OpenPGP key,
+// and decrypted with the identity files in Config.Identities.
+const ageExt = ".age"
+
+// isAgeRecipient reports whether user is an age or SSH public key rather
+// than an OpenPGP user: an age1... string, or an ssh-... key type followed
+// by a space. Emails starting with either prefix are OpenPGP users.
+func isAgeRecipient(user string) bool {
+	if strings.HasPrefix(user, "age1") {
+		return !strings.Contains(user, "@")
+	}
+	i := strings.IndexAny(user, " \t")
+	return i > 0 && isSSHKeyType(user[:i])
+}
+
+// isSSHKeyType reports whether s looks like the type of an SSH public key,
+// such as ssh-ed25519 or ssh-rsa.
+func isSSHKeyType(s string) bool {
+	return strings.HasPrefix(s, "ssh-") && !strings.Contains(s, "@")
+}
+
+// ageKey returns the key for the age or SSH public key user.
+func ageKey(user string) (*Key, error) {
+	if strings.HasPrefix(user, "ssh-") {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(user))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH public key: %v", err)
+		}
+		r, err := agessh.ParseRecipient(user)
+		if err != nil {
+			return nil, err
+		}
+		return newAgeKey(sshKeyString(pub), r), nil
+	}
+
+	recipients, err := age.ParseRecipients(strings.NewReader(user))
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) != 1 {
+		return nil, fmt.Errorf("invalid age public key %q", user)
+	}
+	return newAgeKey(user, recipients[0]), nil
+}
+
+func newAgeKey(public string, r age.Recipient) *Key {
+	return &Key{
+		SubKeys:    []SubKey{{Fingerprint: public}},
+		CanEncrypt: true,
+		native:     r,
+	}
+}
+
+// sshKeyString returns pub in authorized_keys format without a comment.
+func sshKeyString(pub ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+}
+
+// isAge reports whether k is an age or SSH public key.
+func (k *Key) isAge() bool {
+	_, ok := k.native.(age.Recipient)
+	return ok
+}
+
+// ageName returns the name, without extension, of the vault file encrypted
+// for the age key k.
+func ageName(k *Key) string {
+	sum := sha256.Sum256([]byte(k.Fingerprint()))
+	return "age-" + hex.EncodeToString(sum[:16])
+}
+
+// ageIdentity is an identity read from one of Config.Identities.
+type ageIdentity struct {
+	identity age.Identity
+	key      *Key // the identity's public key
+}
+
+// ageIdentities reads the age identity files and SSH private keys in
+// c.Identities. Files that do not exist are skipped.
+func (c *Config) ageIdentities() ([]ageIdentity, error) {
+	var ids []ageIdentity
+	for _, name := range c.Identities {
+		data, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+			native, err := parseAgeIdentities(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			ids = append(ids, native...)
+			continue
+		}
+
+		id, err := c.sshIdentity(name, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseAgeIdentities parses an age identity file.
+func parseAgeIdentities(data []byte) ([]ageIdentity, error) {
+	parsed, err := age.ParseIdentities(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var ids []ageIdentity
+	for _, id := range parsed {
+		switch id := id.(type) {
+		case *age.X25519Identity:
+			ids = append(ids, ageIdentity{id, newAgeKey(id.Recipient().String(), id.Recipient())})
+		case *age.HybridIdentity:
+			ids = append(ids, ageIdentity{id, newAgeKey(id.Recipient().String(), id.Recipient())})
+		}
+	}
+	return ids, nil
+}
+
+// sshIdentity parses the SSH private key in data, read from name. The
+// public key of a passphrase protected key is read from the key itself or
+// from name.pub, and the passphrase is only asked for when it is used.
+func (c *Config) sshIdentity(name string, data []byte) (ageIdentity, error) {
+	var pub ssh.PublicKey
+	var id age.Identity
+	signer, err := ssh.ParsePrivateKey(data)
+	if err == nil {
+		pub = signer.PublicKey()
+		if id, err = agessh.ParseIdentity(data); err != nil {
+			return ageIdentity{}, err
+		}
+	} else if missing, ok := err.(*ssh.PassphraseMissingError); ok {
+		pub = missing.PublicKey
+		if pub == nil {
+			authorized, err := ioutil.ReadFile(name + ".pub")
+			if err != nil {
+				return ageIdentity{}, err
+			}
+			if pub, _, _, _, err = ssh.ParseAuthorizedKey(authorized); err != nil {
+				return ageIdentity{}, err
+			}
+		}
+		passphrase := func() ([]byte, error) {
+			if c.Passphrase == nil {
+				return nil, fmt.Errorf("%s is passphrase protected", name)
+			}
+			return c.Passphrase(fmt.Sprintf("Passphrase for %s: ", name))
+		}
+		if id, err = agessh.NewEncryptedSSHIdentity(pub, data, passphrase); err != nil {
+			return ageIdentity{}, err
+		}
+	} else {
+		return ageIdentity{}, err
+	}
+
+	r, err := agessh.ParseRecipient(sshKeyString(pub))
+	if err != nil {
+		return ageIdentity{}, err
+	}
+	return ageIdentity{id, newAgeKey(sshKeyString(pub), r)}, nil
+}
+
+// ageEncrypt writes the contents of r to w encrypted to the age keys
+// recipients, ASCII armored if armored is set.
+func ageEncrypt(w io.Writer, r io.Reader, recipients []*Key, armored bool) error {
+	var list []age.Recipient
+	for _, key := range recipients {
+		list = append(list, key.native.(age.Recipient))
+	}
+
+	if armored {
+		aw := armor.NewWriter(w)
+		if err := ageEncrypt(aw, r, recipients, false); err != nil {
+			return err
+		}
+		return aw.Close()
+	}
+
+	plain, err := age.Encrypt(w, list...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(plain, r); err != nil {
+		return err
+	}
+	return plain.Close()
+}
+
+// ageDecrypt returns the contents of the age file read from r, binary or
+// ASCII armored, decrypted with id.
+func ageDecrypt(r io.Reader, id age.Identity) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var cipher io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		cipher = armor.NewReader(cipher)
+	}
+	plain, err := age.Decrypt(cipher, id)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(plain)
+}
+
+// decryptAgeFile decrypts the age file name with id and verifies its
+// signature.
+func decryptAgeFile(conf *Config, name string, id *ageIdentity) (*bytes.Buffer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := ageDecrypt(f, id.identity)
+	if err != nil {
+		return nil, err
+	}
+	return conf.verify(name, msg)
+}
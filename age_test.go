@@ -0,0 +1,140 @@
+package ponder
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestIsAgeRecipient(t *testing.T) {
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p", true},
+		{"ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIHsKLqeplhpW+uObz5dvMgjz1OxfM/XXUB+VHtZ6isGN", true},
+		{"ssh-rsa AAAA carol@laptop", true},
+		{"ssh-team@example.com", false},
+		{"age1team@example.com", false},
+		{"alice@example.com", false},
+		{"AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB", false},
+	}
+	for _, tt := range tests {
+		if got := isAgeRecipient(tt.user); got != tt.want {
+			t.Errorf("isAgeRecipient(%q) = %v, want %v", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestSplitMembers(t *testing.T) {
+	got := splitMembers("ssh-team@example.com, ssh-ed25519 AAAA, bob@example.com")
+	want := []string{"ssh-team@example.com", "ssh-ed25519 AAAA", "bob@example.com"}
+	if !equalStrings(got, want) {
+		t.Errorf("splitMembers() = %q, want %q", got, want)
+	}
+}
+
+// newSSHIdentity returns a new SSH ed25519 identity and its public key in
+// authorized_keys format.
+func newSSHIdentity(t *testing.T) (age.Identity, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := agessh.NewEd25519Identity(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, sshKeyString(sshPub)
+}
+
+func TestAgeKey(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ageKey(x25519.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.isAge() || key.Fingerprint() != x25519.Recipient().String() {
+		t.Errorf("ageKey(age1...) = %+v", key)
+	}
+
+	_, public := newSSHIdentity(t)
+	key, err = ageKey(public + " carol@laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.isAge() || key.Fingerprint() != public {
+		t.Errorf("ageKey(ssh-ed25519...) fingerprint = %q, want %q without the comment", key.Fingerprint(), public)
+	}
+	if !strings.HasPrefix(ageName(key), "age-") {
+		t.Errorf("ageName() = %q", ageName(key))
+	}
+
+	for _, bad := range []string{"age1notakey", "ssh-ed25519 notbase64"} {
+		if _, err := ageKey(bad); err == nil {
+			t.Errorf("ageKey(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAgeEncryptDecrypt(t *testing.T) {
+	x25519, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshID, public := newSSHIdentity(t)
+	var recipients []*Key
+	for _, user := range []string{x25519.Recipient().String(), public} {
+		key, err := ageKey(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, key)
+	}
+
+	plain := "[web]\npassword = xx\n"
+	for _, armored := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		if err := ageEncrypt(buf, strings.NewReader(plain), recipients, armored); err != nil {
+			t.Fatal(err)
+		}
+		msg := buf.Bytes()
+		if got := bytes.HasPrefix(msg, []byte("-----BEGIN AGE")); got != armored {
+			t.Errorf("armored = %v, but output armored is %v", armored, got)
+		}
+		for _, id := range []age.Identity{x25519, sshID} {
+			out, err := ageDecrypt(bytes.NewReader(msg), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != plain {
+				t.Errorf("ageDecrypt() = %q, want %q", out, plain)
+			}
+		}
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := ageEncrypt(buf, strings.NewReader(plain), recipients, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ageDecrypt(buf, other); err == nil {
+		t.Errorf("decrypted with an identity that is not a recipient")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdEdit = &Command{
+	Run:       runEdit,
+	UsageLine: "edit",
+	Short:     "edit the password vault",
+	Long: `
+Edit decrypts the vault, opens it in $EDITOR (vim by default) and
+re-encrypts the result for every user listed in the ACCESS section.
+
+The editor works on a copy in a private directory under /dev/shm or
+$XDG_RUNTIME_DIR, which is overwritten and removed once the vault is saved
+or the edit aborted, or when ponder is interrupted, hung up on or
+terminated. Interrupts while the editor runs are left to the editor. Edit
+refuses to run when neither directory is available, unless given the
+global -force-disk flag.
+
+Before saving, the edited vault is checked for syntax errors, a missing
+ACCESS section, invalid ACCESS entries, ACCESS entries naming sections that
+do not exist and recipients without a usable key. Problems are listed and
+you can reopen the editor on your changes, abort without saving, or save
+anyway when the problems only leave out sections or recipients.
+
+The sections and keys added, removed and changed are then listed and
+saving must be confirmed. Values are masked, except in ACCESS, GROUPS and
+SETTINGS, unless -show-values is given. Leaving the vault unmodified saves
+nothing, so every copy is left as it was.
+
+If someone else saved the vault while you were editing it, nothing is
+written. Edit offers to merge both sets of changes, section by section,
+and reopens the editor on the result. Sections changed on both sides keep
+your version, with theirs in a CONFLICT comment above it. The vault
+cannot be saved until every CONFLICT comment is resolved and removed.
+`,
+	Flag: flag.NewFlagSet("edit", flag.ExitOnError),
+}
+
+var editShowValues bool
+
+func init() {
+	cmdEdit.Flag.BoolVar(&editShowValues, "show-values", false, "show the old and new values of changed keys")
+}
+
+func runEdit(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	vault, err := ponder.OpenWritable(conf)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if _, err := vault.WriteTo(buf); err != nil {
+		return err
+	}
+	return editString(vault, buf.String())
+}
+
+// editString opens the editor on text and saves the result as an edit of
+// old. The changes from old are shown and confirmed first; a nil old saves
+// a new vault without asking.
+func editString(old *ponder.Vault, text string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vim"
+	}
+
+	oldText := new(bytes.Buffer)
+	if old != nil {
+		if _, err := old.WriteTo(oldText); err != nil {
+			return err
+		}
+	}
+
+	dir, err := newTempDir(*forceDisk)
+	if err != nil {
+		return err
+	}
+	defer dir.Remove()
+
+	name, err := dir.WriteFile("vault.ini", []byte(text))
+	if err != nil {
+		return err
+	}
+
+	var vault *ponder.Vault
+edit:
+	for {
+		cmd := exec.Command(editor, name)
+
+		// without setting std correctly editor will not launch
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := dir.Run(cmd); err != nil {
+			return err
+		}
+		plain, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if old != nil && bytes.Equal(plain, oldText.Bytes()) {
+			fmt.Fprintln(os.Stderr, "No changes, nothing was saved.")
+			return nil
+		}
+
+		problems, err := ponder.Check(conf, plain)
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			vault, err = ponder.Parse(conf, plain)
+		} else {
+			vault, err = old.Edit(plain)
+		}
+		if err == nil && old != nil {
+			changes := ponder.Diff(old, vault)
+			for _, c := range changes {
+				fmt.Println(c.Format(editShowValues))
+			}
+			if len(changes) == 0 {
+				fmt.Println("Only comments or layout changed.")
+			}
+		}
+		if len(problems) == 0 && old == nil {
+			break
+		}
+
+		fatal := false
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, p)
+			fatal = fatal || p.Fatal
+		}
+		question, answer := "(s)ave, (r)eopen the editor or (a)bort? [s] ", "s"
+		switch {
+		case fatal:
+			question, answer = "(r)eopen the editor or (a)bort? [r] ", "r"
+		case len(problems) > 0:
+			question, answer = "(r)eopen the editor, (a)bort or (s)ave anyway? [r] ", "r"
+		}
+		for {
+			reply, err := ask(question)
+			if err != nil {
+				return err
+			}
+			if reply == "" {
+				reply = answer
+			}
+			switch {
+			case reply == "r":
+				continue edit
+			case reply == "a":
+				return errAborted
+			case reply == "s" && !fatal:
+				// Recipients without a usable key are skipped.
+				conf.AllowMissing = conf.AllowMissing || len(problems) > 0
+				break edit
+			}
+		}
+	}
+	dir.Remove()
+	return save(vault)
+}
+
+// save saves vault and, if someone else saved the vault in the meantime,
+// offers to merge their changes and edit the result.
+func save(vault *ponder.Vault) error {
+	err := vault.Save()
+	conflict, ok := err.(*ponder.ConflictError)
+	if !ok {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%v.\n", err)
+
+	merged, sections, err := ponder.Merge(conflict.Base, vault, conflict.Theirs)
+	if err != nil {
+		return err
+	}
+	if len(sections) > 0 {
+		fmt.Fprintf(os.Stderr, "Both changed %s: your version is kept, with theirs in a comment.\n", strings.Join(sections, ", "))
+	}
+	for {
+		reply, err := ask("(m)erge your changes with theirs and review the result, or (a)bort? [m] ")
+		if err != nil {
+			return err
+		}
+		switch reply {
+		case "", "m":
+			buf := new(bytes.Buffer)
+			if _, err := merged.WriteTo(buf); err != nil {
+				return err
+			}
+			return editString(conflict.Theirs, buf.String())
+		case "a":
+			return errAborted
+		}
+	}
+}
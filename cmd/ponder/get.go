@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdGet = &Command{
+	Run:       runGet,
+	UsageLine: "get [-n] [-json] section key",
+	Short:     "print a single value",
+	Long: `
+Get decrypts the vault and prints the value of key in section.
+
+Subsections are addressed with dots, as in 'ponder get myhost.prod password'.
+A key missing from a subsection is looked up in its parent sections.
+
+Get exits with status 3 when the section does not exist and 4 when the
+section exists but the key does not.
+`,
+	Flag: flag.NewFlagSet("get", flag.ExitOnError),
+}
+
+var (
+	getNoNewline bool
+	getJSON      bool
+)
+
+func init() {
+	cmdGet.Flag.BoolVar(&getNoNewline, "n", false, "do not print a trailing newline")
+	cmdGet.Flag.BoolVar(&getJSON, "json", false, "print the section, key and value as a JSON object")
+}
+
+func runGet(cmd *Command, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	vault, err := ponder.Open(conf)
+	if err != nil {
+		return err
+	}
+	section, key := args[0], args[1]
+	value, err := vault.Get(section, key)
+	if err != nil {
+		return err
+	}
+
+	if getJSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Section string `json:"section"`
+			Key     string `json:"key"`
+			Value   string `json:"value"`
+		}{section, key, value})
+	}
+
+	if getNoNewline {
+		fmt.Print(value)
+	} else {
+		fmt.Println(value)
+	}
+	return nil
+}
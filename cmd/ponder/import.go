@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdImport = &Command{
+	Run:       runImport,
+	UsageLine: "import [file...]",
+	Short:     "import public keys into the vault keyring",
+	Long: `
+Import adds the public keys in the named files, or standard input, to the
+vault keyring in .ponder/keyring, creating it if needed. While the vault
+has a keyring, the gpgme backend encrypts to and checks signatures with
+the keys in it instead of your own keyring, and trusts them all, so every
+team member encrypts to the same keys. Secret keys still come from your own
+keyring.
+
+The keyring is a GnuPG home directory: use gpg --homedir .ponder/keyring
+to inspect or remove keys. Vaults with a keys directory sync the keyring
+with it instead; use ponder keys add there.
+`,
+	Flag: flag.NewFlagSet("import", flag.ExitOnError),
+}
+
+func runImport(cmd *Command, args []string) error {
+	if len(args) == 0 {
+		return ponder.ImportKeys(conf, os.Stdin)
+	}
+	var files []io.Reader
+	for _, name := range args {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+	return ponder.ImportKeys(conf, io.MultiReader(files...))
+}
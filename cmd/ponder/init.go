@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdInit = &Command{
+	Run:       runInit,
+	UsageLine: "init",
+	Short:     "initialize a new password vault",
+	Long: `
+Init opens $EDITOR on a template vault granting the first key in the
+keyring access to everything, then encrypts the result for every user
+listed in the ACCESS section.
+`,
+	Flag: flag.NewFlagSet("init", flag.ExitOnError),
+}
+
+func runInit(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	text, err := ponder.Template(conf)
+	if err != nil {
+		return err
+	}
+	return editString(nil, text)
+}
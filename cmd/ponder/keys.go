@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdKeys = &Command{
+	Run:       runKeys,
+	UsageLine: "keys add [file...] | keys remove user | keys list",
+	Short:     "manage the team public keys in the vault",
+	Long: `
+Keys manages the keys directory of the vault: the armored public keys of
+the team, one keys/<fingerprint>.asc file per key, meant to be committed
+along with the vault.
+
+Keys add adds the public keys in the named files, or standard input, to the
+keys directory. Keys remove removes the key with the given fingerprint or
+email. Keys list prints the fingerprint and user IDs of every key.
+
+Before each save, the gpgme backend imports the keys directory into the
+vault keyring in .ponder/keyring and drops any other key from it, so that
+everyone encrypts to the same keys; import is refused while the vault has
+a keys directory. The openpgp backend reads the keys
+directory along with its keyring file. Both trust every key in it.
+`,
+	Flag: flag.NewFlagSet("keys", flag.ExitOnError),
+}
+
+func runKeys(cmd *Command, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "add":
+		return runKeysAdd(args[1:])
+	case "remove":
+		if len(args) != 2 {
+			return errUsage
+		}
+		keys, err := ponder.RemoveKeys(conf, args[1])
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Printf("removed %s\n", key.Fingerprint)
+		}
+		return nil
+	case "list":
+		if len(args) != 1 {
+			return errUsage
+		}
+		keys, err := ponder.ListKeys(conf)
+		if err != nil {
+			return err
+		}
+		printKeys(keys)
+		return nil
+	}
+	return errUsage
+}
+
+func runKeysAdd(args []string) error {
+	var r io.Reader = os.Stdin
+	if len(args) > 0 {
+		var files []io.Reader
+		for _, name := range args {
+			f, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			files = append(files, f)
+		}
+		r = io.MultiReader(files...)
+	}
+	keys, err := ponder.AddKeys(conf, r)
+	if err != nil {
+		return err
+	}
+	printKeys(keys)
+	return nil
+}
+
+func printKeys(keys []ponder.TeamKey) {
+	for _, key := range keys {
+		fmt.Printf("%s %s\n", key.Fingerprint, strings.Join(key.UserIDs, ", "))
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdLog = &Command{
+	Run:       runLog,
+	UsageLine: "log",
+	Short:     "show the history of the vault",
+	Long: `
+Log prints the git history of the vault files, newest first. With -git, or
+git = true in ~/.ponderrc, every save is committed with a message naming
+the sections changed, never their values, and the key that signed it.
+`,
+	Flag: flag.NewFlagSet("log", flag.ExitOnError),
+}
+
+func runLog(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return ponder.Log(conf, os.Stdout)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdLs = &Command{
+	Run:       runLs,
+	UsageLine: "ls [section]",
+	Short:     "list sections or keys",
+	Long: `
+Ls lists the sections in the vault. Given a section, it lists the keys in
+that section instead. Values are never printed.
+`,
+	Flag: flag.NewFlagSet("ls", flag.ExitOnError),
+}
+
+func runLs(cmd *Command, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	vault, err := ponder.Open(conf)
+	if err != nil {
+		return err
+	}
+
+	names := vault.Sections()
+	if len(args) == 1 {
+		names, err = vault.Keys(args[0])
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
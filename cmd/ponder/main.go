@@ -0,0 +1,330 @@
+// Command ponder manages a shared GPG encrypted password vault.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+// A Command is an implementation of a ponder subcommand.
+type Command struct {
+	// Run runs the command. The args are the arguments after the
+	// command name and its flags.
+	Run func(cmd *Command, args []string) error
+
+	// UsageLine is the one-line usage message. The first word is the
+	// command name.
+	UsageLine string
+
+	// Short is the short description shown in 'ponder help'.
+	Short string
+
+	// Long is the long message shown in 'ponder help <command>'.
+	Long string
+
+	// Flag is the set of flags specific to this command.
+	Flag *flag.FlagSet
+}
+
+// Name returns the command's name: the first word in the usage line.
+func (c *Command) Name() string {
+	name := c.UsageLine
+	if i := strings.Index(name, " "); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// Usage prints the command's usage and flags to stderr.
+func (c *Command) Usage() {
+	fmt.Fprintf(os.Stderr, "usage: ponder %s\n\n", c.UsageLine)
+	fmt.Fprintf(os.Stderr, "%s\n", strings.TrimSpace(c.Long))
+	if hasFlags(c.Flag) {
+		fmt.Fprintf(os.Stderr, "\nFlags:\n")
+		c.Flag.PrintDefaults()
+	}
+}
+
+// errUsage is returned by commands invoked with the wrong arguments.
+var errUsage = errors.New("bad usage")
+
+// errAborted is returned when the user gives up on saving an edit.
+var errAborted = errors.New("aborted, nothing was saved")
+
+// Exit statuses.
+const (
+	exitOK        = 0
+	exitError     = 1
+	exitUsage     = 2
+	exitNoSection = 3
+	exitNoKey     = 4
+)
+
+// exitStatus maps an error returned by a command to the process exit status.
+func exitStatus(err error) int {
+	switch err {
+	case nil:
+		return exitOK
+	case errUsage:
+		return exitUsage
+	case ponder.ErrSectionNotFound:
+		return exitNoSection
+	case ponder.ErrKeyNotFound:
+		return exitNoKey
+	}
+	return exitError
+}
+
+// conf is the configuration shared by all commands, loaded from the config
+// file and environment and overridden by the global flags.
+var conf *ponder.Config
+
+var (
+	vaultDir     = flag.String("vault", "", "`directory` holding the encrypted vault files")
+	allowMissing = flag.Bool("allow-missing", false, "save even when some recipients have no usable key")
+	armor        = flag.Bool("armor", false, "write ASCII armored .asc vault files")
+	minValidity  = flag.String("min-validity", "", "least `validity` (marginal, full, ultimate) a recipient's user ID must have")
+	backend      = flag.String("backend", "", "crypto `backend`: "+strings.Join(ponder.Backends(), " or "))
+	keyring      = flag.String("keyring", "", "armored keyring `file` used by the openpgp backend")
+	identity     = flag.String("identity", "", "age identity or SSH private key `file` to decrypt with")
+	homedir      = flag.String("homedir", "", "GnuPG home `directory` of the vault keyring")
+	useGit       = flag.Bool("git", false, "commit the vault files to git after saving")
+	lockTimeout  = flag.Duration("lock-timeout", 0, "how long to wait for another process writing the vault (default 10s)")
+	forceDisk    = flag.Bool("force-disk", false, "let the editor's plaintext copy of the vault touch the disk when no memory backed directory is available")
+)
+
+var commands = []*Command{
+	cmdInit,
+	cmdEdit,
+	cmdShow,
+	cmdGet,
+	cmdSet,
+	cmdLs,
+	cmdRm,
+	cmdWhoami,
+	cmdRekey,
+	cmdMigrate,
+	cmdImport,
+	cmdKeys,
+	cmdLog,
+	cmdSync,
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ponder: ")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+	}
+
+	var err error
+	conf, err = ponder.LoadConfig(ponder.DefaultConfigPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *vaultDir != "" {
+		conf.Dir = *vaultDir
+	}
+	conf.AllowMissing = *allowMissing
+	if *armor {
+		conf.Armor = true
+	}
+	if *minValidity != "" {
+		if conf.MinValidity, err = ponder.ParseValidity(*minValidity); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *backend != "" {
+		conf.Backend = *backend
+	}
+	if *keyring != "" {
+		conf.Keyring = *keyring
+	}
+	if *identity != "" {
+		conf.Identities = []string{*identity}
+	}
+	if *homedir != "" {
+		conf.Homedir = *homedir
+	}
+	if *useGit {
+		conf.Git = true
+	}
+	if *lockTimeout != 0 {
+		conf.LockTimeout = *lockTimeout
+	}
+	conf.Passphrase = readPassphrase
+	conf.Warn = func(msg string) {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", msg)
+	}
+
+	if args[0] == "help" {
+		help(args[1:])
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name() != args[0] {
+			continue
+		}
+		cmd.Flag.Usage = cmd.Usage
+		err := cmd.Run(cmd, parseArgs(cmd.Flag, args[1:]))
+		if err == errUsage {
+			cmd.Usage()
+		} else if err != nil {
+			log.Print(err)
+			if _, ok := err.(*ponder.MissingKeysError); ok {
+				fmt.Fprintf(os.Stderr, "Nothing was saved. Use 'ponder -allow-missing' to skip these recipients.\n")
+			}
+		}
+		os.Exit(exitStatus(err))
+	}
+
+	fmt.Fprintf(os.Stderr, "ponder: unknown subcommand %q\nRun 'ponder help' for usage.\n", args[0])
+	os.Exit(exitUsage)
+}
+
+// parseArgs parses the flags in args, which unlike flag.Parse may follow
+// the positional arguments, and returns the positional arguments. Every
+// argument after "--" is positional, even if it starts with a dash.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+var usageTemplate = `Ponder is a tool for managing a shared password vault.
+
+Usage:
+
+	ponder [global flags] command [arguments]
+
+The vault directory defaults to $PONDER_DIR, then the dir setting in
+~/.ponderrc ($PONDER_CONFIG), then the current directory.
+
+Saving fails if a recipient has no usable key: none in the keyring, or
+only revoked, expired, disabled, invalid or non-encrypting ones, or ones
+whose user ID is less valid than -min-validity. Pass -allow-missing to
+skip such recipients instead.
+
+The commands are:
+{{range .}}
+	{{.Name | printf "%-8s"}} {{.Short}}{{end}}
+
+Use "ponder help [command]" for more information about a command.
+
+The global flags are:
+
+`
+
+func usage() {
+	printUsage()
+	os.Exit(exitUsage)
+}
+
+func printUsage() {
+	tmpl := template.Must(template.New("usage").Parse(usageTemplate))
+	tmpl.Execute(os.Stderr, commands)
+	flag.PrintDefaults()
+}
+
+func help(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		return
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: ponder help command\n\nToo many arguments given.\n")
+		os.Exit(exitUsage)
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name() == args[0] {
+			cmd.Usage()
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown help topic %q. Run 'ponder help'.\n", args[0])
+	os.Exit(exitUsage)
+}
+
+// readPassphrase returns $PONDER_PASSPHRASE if set, and otherwise reads a
+// passphrase from the terminal without echoing it.
+func readPassphrase(prompt string) ([]byte, error) {
+	if pass := os.Getenv("PONDER_PASSPHRASE"); pass != "" {
+		return []byte(pass), nil
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+
+	stty := func(arg string) error {
+		cmd := exec.Command("stty", arg)
+		cmd.Stdin = tty
+		return cmd.Run()
+	}
+	fmt.Fprint(tty, prompt)
+	if err := stty("-echo"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		stty("echo")
+		fmt.Fprintln(tty)
+	}()
+
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// ask prints question on the terminal and returns the line typed in
+// reply, trimmed and lower cased.
+func ask(question string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, question)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(line)), nil
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	any := false
+	fs.VisitAll(func(*flag.Flag) { any = true })
+	return any
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		stdin      bool
+	}{
+		{[]string{"myhost", "password", "s3cr3t"}, []string{"myhost", "password", "s3cr3t"}, false},
+		{[]string{"-stdin", "myhost", "password"}, []string{"myhost", "password"}, true},
+		{[]string{"myhost", "password", "--stdin"}, []string{"myhost", "password"}, true},
+		{[]string{"myhost", "-stdin", "password"}, []string{"myhost", "password"}, true},
+		{[]string{"myhost", "password", "--", "--stdin"}, []string{"myhost", "password", "--stdin"}, false},
+		{[]string{"--", "-stdin", "-"}, []string{"-stdin", "-"}, false},
+		{nil, nil, false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("set", flag.ContinueOnError)
+		stdin := fs.Bool("stdin", false, "")
+		positional := parseArgs(fs, tt.args)
+		if !equal(positional, tt.positional) || *stdin != tt.stdin {
+			t.Errorf("parseArgs(%q) = %q, stdin %v, want %q, stdin %v", tt.args, positional, *stdin, tt.positional, tt.stdin)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
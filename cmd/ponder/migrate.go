@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdMigrate = &Command{
+	Run:       runMigrate,
+	UsageLine: "migrate",
+	Short:     "rename key ID vault files to fingerprints",
+	Long: `
+Migrate renames vault files named after a 16 character key ID, as written
+by older versions of ponder, to the full fingerprint of the matching key in
+the keyring. Files that already have a fingerprint name are left alone.
+
+ACCESS entries naming key IDs must be changed to fingerprints by hand.
+`,
+	Flag: flag.NewFlagSet("migrate", flag.ExitOnError),
+}
+
+func runMigrate(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	renamed, err := ponder.MigrateFilenames(conf)
+	for _, name := range renamed {
+		fmt.Printf("renamed %s\n", name)
+	}
+	return err
+}
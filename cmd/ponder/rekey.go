@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdRekey = &Command{
+	Run:       runRekey,
+	UsageLine: "rekey",
+	Short:     "regenerate every user's vault file from the master copy",
+	Long: `
+Rekey decrypts the master copy of the vault, which is encrypted to every
+admin, and re-encrypts each user's file from it. Use it to restore access
+after keys change, without needing a user who can read everything. Unlike
+other commands, it writes every file even when the vault is unchanged.
+`,
+	Flag: flag.NewFlagSet("rekey", flag.ExitOnError),
+}
+
+func runRekey(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	vault, err := ponder.OpenMaster(conf)
+	if err != nil {
+		return err
+	}
+	return vault.Rekey()
+}
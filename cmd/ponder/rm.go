@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdRm = &Command{
+	Run:       runRm,
+	UsageLine: "rm [-r] section [key]",
+	Short:     "remove a section or key",
+	Long: `
+Rm decrypts the vault, removes key from section, or the whole section when
+no key is given, and re-encrypts the vault for every user without opening
+an editor.
+
+With -r, removing a section also removes its subsections, so
+'ponder rm -r myhost' removes myhost, myhost.prod and so on.
+`,
+	Flag: flag.NewFlagSet("rm", flag.ExitOnError),
+}
+
+var rmRecursive bool
+
+func init() {
+	cmdRm.Flag.BoolVar(&rmRecursive, "r", false, "also remove subsections")
+}
+
+func runRm(cmd *Command, args []string) error {
+	if len(args) < 1 || len(args) > 2 || (rmRecursive && len(args) != 1) {
+		return errUsage
+	}
+	vault, err := ponder.OpenWritable(conf)
+	if err != nil {
+		return err
+	}
+
+	section := args[0]
+	var key string
+	if len(args) == 2 {
+		key = args[1]
+	}
+	if err := vault.Delete(section, key); err != nil {
+		return err
+	}
+	if rmRecursive {
+		for _, name := range vault.Sections() {
+			if strings.HasPrefix(name, section+".") {
+				if err := vault.Delete(name, ""); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return vault.Save()
+}
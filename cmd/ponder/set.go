@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdSet = &Command{
+	Run:       runSet,
+	UsageLine: "set [-stdin] section key [value]",
+	Short:     "store a single value",
+	Long: `
+Set decrypts the vault, stores value under key in section, creating the
+section if needed, and re-encrypts the vault for every user without
+opening an editor.
+
+With -stdin the value is read from standard input instead of the command
+line, keeping it out of shell history and process listings. A single
+trailing newline is removed. Flags may also follow the arguments, so a
+value starting with a dash must come after --:
+
+	ponder set myhost password -- -s3cr3t
+`,
+	Flag: flag.NewFlagSet("set", flag.ExitOnError),
+}
+
+var setStdin bool
+
+func init() {
+	cmdSet.Flag.BoolVar(&setStdin, "stdin", false, "read the value from standard input")
+}
+
+func runSet(cmd *Command, args []string) error {
+	var value string
+	switch {
+	case setStdin && len(args) == 2:
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		value = strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	case !setStdin && len(args) == 3:
+		value = args[2]
+	default:
+		return errUsage
+	}
+
+	vault, err := ponder.OpenWritable(conf)
+	if err != nil {
+		return err
+	}
+	if err := vault.Set(args[0], args[1], value); err != nil {
+		return err
+	}
+	return vault.Save()
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdShow = &Command{
+	Run:       runShow,
+	UsageLine: "show",
+	Short:     "print the decrypted vault",
+	Long: `
+Show decrypts the vault and prints it to stdout as INI.
+`,
+	Flag: flag.NewFlagSet("show", flag.ExitOnError),
+}
+
+func runShow(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	vault, err := ponder.Open(conf)
+	if err != nil {
+		return err
+	}
+	_, err = vault.WriteTo(os.Stdout)
+	return err
+}
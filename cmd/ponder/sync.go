@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdSync = &Command{
+	Run:       runSync,
+	UsageLine: "sync",
+	Short:     "pull the latest vault from its git remote",
+	Long: `
+Sync runs git pull --rebase in the vault directory, so that edits start
+from the latest vault and local commits are replayed on top of it. Run it
+before editing a vault kept in git.
+`,
+	Flag: flag.NewFlagSet("sync", flag.ExitOnError),
+}
+
+func runSync(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return ponder.Sync(conf, os.Stderr)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// errDiskTemp is returned when the decrypted vault could only be handed to
+// the editor through a file on persistent disk.
+var errDiskTemp = errors.New("no memory backed directory for the plaintext (/dev/shm or $XDG_RUNTIME_DIR); use -force-disk to use the default temporary directory anyway")
+
+// memoryDirs returns the directories, in order of preference, where files
+// live in memory and never reach the disk.
+func memoryDirs() []string {
+	dirs := []string{"/dev/shm"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// tempDir is a private directory holding plaintext for the editor. Its
+// files are overwritten before they are removed.
+type tempDir struct {
+	name    string
+	once    sync.Once
+	sigs    chan os.Signal
+	editing int32 // set while Run waits for the editor
+}
+
+// newTempDir creates a 0700 directory in the first usable memory backed
+// directory, or in the default temporary directory if forceDisk is set.
+// The directory is cleaned up when ponder is interrupted, hung up on or
+// terminated; callers must call Remove when done with it.
+func newTempDir(forceDisk bool) (*tempDir, error) {
+	var name string
+	for _, dir := range memoryDirs() {
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			continue
+		}
+		var err error
+		if name, err = ioutil.TempDir(dir, "ponder-"); err == nil {
+			break
+		}
+	}
+	if name == "" {
+		if !forceDisk {
+			return nil, errDiskTemp
+		}
+		var err error
+		if name, err = ioutil.TempDir("", "ponder-"); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Chmod(name, 0700); err != nil {
+		os.Remove(name)
+		return nil, err
+	}
+
+	d := &tempDir{name: name, sigs: make(chan os.Signal, 1)}
+	signal.Notify(d.sigs, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
+	go func() {
+		for sig := range d.sigs {
+			if sig == os.Interrupt && atomic.LoadInt32(&d.editing) == 1 {
+				continue
+			}
+			d.Remove()
+			os.Exit(exitError)
+		}
+	}()
+	return d, nil
+}
+
+// Run runs the editor cmd on the files in d. Interrupts reach the editor
+// too, which decides what they mean, so ponder keeps waiting for it
+// instead of dying with the plaintext left behind.
+func (d *tempDir) Run(cmd *exec.Cmd) error {
+	atomic.StoreInt32(&d.editing, 1)
+	defer atomic.StoreInt32(&d.editing, 0)
+	return cmd.Run()
+}
+
+// WriteFile writes data to the file base in d, readable by the user only,
+// and returns its name.
+func (d *tempDir) WriteFile(base string, data []byte) (string, error) {
+	name := filepath.Join(d.name, base)
+	return name, ioutil.WriteFile(name, data, 0600)
+}
+
+// Remove overwrites every file in d, including any backup or swap files
+// the editor left, with zeros and removes d. It is safe to call more than
+// once and from a signal handler.
+func (d *tempDir) Remove() {
+	d.once.Do(func() {
+		signal.Stop(d.sigs)
+		close(d.sigs)
+		filepath.Walk(d.name, func(name string, fi os.FileInfo, err error) error {
+			if err == nil && fi.Mode().IsRegular() {
+				wipe(name, fi.Size())
+			}
+			return nil
+		})
+		os.RemoveAll(d.name)
+	})
+}
+
+// wipe overwrites the first size bytes of the file name with zeros.
+func wipe(name string, size int64) {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	zeros := make([]byte, 4096)
+	for size > 0 {
+		n := int64(len(zeros))
+		if size < n {
+			n = size
+		}
+		if _, err := f.Write(zeros[:n]); err != nil {
+			return
+		}
+		size -= n
+	}
+	f.Sync()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/FoundersFactory/ponder"
+)
+
+var cmdWhoami = &Command{
+	Run:       runWhoami,
+	UsageLine: "whoami",
+	Short:     "show which sections the current key can read",
+	Long: `
+Whoami decrypts the vault and prints the key it was decrypted with, the
+ACCESS entries that apply to it, whether it receives the full vault
+metadata, and the sections it can read.
+`,
+	Flag: flag.NewFlagSet("whoami", flag.ExitOnError),
+}
+
+func runWhoami(cmd *Command, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	vault, err := ponder.Open(conf)
+	if err != nil {
+		return err
+	}
+	w, err := vault.Whoami()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("key:      %s\n", w.Fingerprint)
+	fmt.Printf("email:    %s\n", w.Email)
+	fmt.Printf("admin:    %t\n", w.Admin)
+	fmt.Printf("entries:  %s\n", strings.Join(w.Entries, ", "))
+	fmt.Printf("sections:\n")
+	for _, name := range w.Sections {
+		fmt.Printf("\t%s\n", name)
+	}
+	return nil
+}
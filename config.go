@@ -0,0 +1,270 @@
+package ponder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-ini/ini"
+)
+
+// Config holds the local settings used to open and save a vault. It is
+// read from an INI file, by default ~/.ponderrc:
+//
+//	dir             = ~/src/team-vault
+//	min-validity    = full
+//	signer          = alice@example.com
+//	trusted-writers = AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB
+//	verify          = require
+//	armor           = true
+//	backend         = openpgp
+//	keyring         = ~/.ponder/keyring.asc
+//	identities      = ~/.ssh/id_ed25519, ~/.config/age/keys.txt
+//	homedir         = .ponder/keyring
+//	lock-timeout    = 30s
+//	git             = true
+//
+// and PONDER_* environment variables take precedence over the file.
+type Config struct {
+	// Dir is the directory holding the encrypted vault files.
+	Dir string
+
+	// AllowMissing saves the vault even when some recipients have no
+	// usable key, skipping them instead of failing.
+	AllowMissing bool
+
+	// MinValidity is the least validity, as computed by the keyring's web
+	// of trust, a recipient's user ID must have. The zero value accepts
+	// any key.
+	MinValidity Validity
+
+	// Signer is the email or fingerprint of the secret key vault files
+	// are signed with. When empty the first secret key able to sign is
+	// used.
+	Signer string
+
+	// TrustedWriters lists the primary key fingerprints of the keys whose
+	// signatures are accepted on vault files, besides the user's own
+	// secret keys. Emails are not accepted, see findKey.
+	TrustedWriters []string
+
+	// Verify is what happens when a vault file is unsigned or not signed
+	// by a trusted writer: VerifyWarn or VerifyRequire.
+	Verify string
+
+	// Armor writes ASCII armored .asc vault files instead of binary .gpg
+	// ones. Both are read regardless.
+	Armor bool
+
+	// Backend names the Crypter used: "gpgme", which needs cgo and
+	// libgpgme, or the pure Go "openpgp". When empty gpgme is used if it
+	// was compiled in.
+	Backend string
+
+	// Keyring is the armored keyring file the openpgp backend reads public
+	// and secret keys from.
+	Keyring string
+
+	// Passphrase, if set, is called by the openpgp backend to unlock a
+	// passphrase protected secret key.
+	Passphrase func(prompt string) ([]byte, error)
+
+	// Warn, if set, is called with the problems that do not stop a vault
+	// from being read or saved: files not signed by a trusted writer in
+	// VerifyWarn mode, recipients skipped with AllowMissing and a master
+	// copy removed for lack of admin keys. They are dropped when nil.
+	Warn func(msg string)
+
+	// Identities lists the age identity files and SSH private keys tried
+	// when the keyring has no key for any vault file. It defaults to
+	// ~/.ssh/id_ed25519 and ~/.ssh/id_rsa.
+	Identities []string
+
+	// Homedir is the GnuPG home directory holding the public keys the
+	// gpgme backend encrypts to and verifies with, relative to Dir. When
+	// empty, Dir/.ponder/keyring is used if it or the keys directory
+	// exists, and the user's own keyring otherwise. Secret keys always
+	// come from the user's keyring.
+	Homedir string
+
+	// LockTimeout is how long saving waits for another process writing
+	// the vault to finish before failing with ErrLocked.
+	LockTimeout time.Duration
+
+	// Git commits the vault files after each save. The vault directory
+	// must be in a git repository.
+	Git bool
+
+	crypt Crypter // opened on first use by crypter
+}
+
+// DefaultConfigPath returns the config file named by $PONDER_CONFIG,
+// falling back to ~/.ponderrc.
+func DefaultConfigPath() string {
+	if path := os.Getenv("PONDER_CONFIG"); path != "" {
+		return path
+	}
+	return expandHome("~/.ponderrc")
+}
+
+// LoadConfig reads the config file at path, if it exists, and applies
+// environment overrides:
+//
+//	PONDER_DIR   the vault directory
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{
+		Dir:         ".",
+		Verify:      VerifyWarn,
+		Keyring:     expandHome("~/.ponder/keyring.asc"),
+		Identities:  []string{expandHome("~/.ssh/id_ed25519"), expandHome("~/.ssh/id_rsa")},
+		LockTimeout: DefaultLockTimeout,
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		file, err := ini.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		sec := file.Section("")
+		if sec.HasKey("dir") {
+			c.Dir = expandHome(sec.Key("dir").Value())
+		}
+		if sec.HasKey("min-validity") {
+			if c.MinValidity, err = ParseValidity(sec.Key("min-validity").Value()); err != nil {
+				return nil, fmt.Errorf("%s: min-validity: %v", path, err)
+			}
+		}
+		if sec.HasKey("signer") {
+			c.Signer = sec.Key("signer").Value()
+		}
+		if sec.HasKey("trusted-writers") {
+			c.TrustedWriters = splitList(sec.Key("trusted-writers").Value())
+			for _, writer := range c.TrustedWriters {
+				if !isFingerprint(writer) {
+					return nil, fmt.Errorf("%s: trusted-writers: %q is not a key fingerprint", path, writer)
+				}
+			}
+		}
+		if sec.HasKey("verify") {
+			c.Verify = sec.Key("verify").Value()
+			if c.Verify != VerifyWarn && c.Verify != VerifyRequire {
+				return nil, fmt.Errorf("%s: verify: unknown mode %q", path, c.Verify)
+			}
+		}
+		if sec.HasKey("armor") {
+			if c.Armor, err = sec.Key("armor").Bool(); err != nil {
+				return nil, fmt.Errorf("%s: armor: %v", path, err)
+			}
+		}
+		if sec.HasKey("backend") {
+			c.Backend = sec.Key("backend").Value()
+		}
+		if sec.HasKey("keyring") {
+			c.Keyring = expandHome(sec.Key("keyring").Value())
+		}
+		if sec.HasKey("homedir") {
+			c.Homedir = expandHome(sec.Key("homedir").Value())
+		}
+		if sec.HasKey("lock-timeout") {
+			if c.LockTimeout, err = sec.Key("lock-timeout").Duration(); err != nil {
+				return nil, fmt.Errorf("%s: lock-timeout: %v", path, err)
+			}
+		}
+		if sec.HasKey("git") {
+			if c.Git, err = sec.Key("git").Bool(); err != nil {
+				return nil, fmt.Errorf("%s: git: %v", path, err)
+			}
+		}
+		if sec.HasKey("identities") {
+			c.Identities = nil
+			for _, name := range splitList(sec.Key("identities").Value()) {
+				c.Identities = append(c.Identities, expandHome(name))
+			}
+		}
+	}
+
+	if dir := os.Getenv("PONDER_DIR"); dir != "" {
+		c.Dir = dir
+	}
+	return c, nil
+}
+
+// warn passes a warning to c.Warn, if set.
+func (c *Config) warn(format string, args ...interface{}) {
+	if c.Warn != nil {
+		c.Warn(fmt.Sprintf(format, args...))
+	}
+}
+
+// path returns the name of file in the vault directory.
+func (c *Config) path(file string) string {
+	return filepath.Join(c.Dir, file)
+}
+
+// Vault file extensions.
+const (
+	binaryExt = ".gpg"
+	armorExt  = ".asc"
+)
+
+// ext returns the extension of the vault files written with c.
+func (c *Config) ext() string {
+	if c.Armor {
+		return armorExt
+	}
+	return binaryExt
+}
+
+// vaultKeyring is the default GnuPG home of a vault's keyring, relative
+// to the vault directory.
+const vaultKeyring = ".ponder/keyring"
+
+// homedir returns the absolute path of the GnuPG home holding the vault
+// keyring, or "" if the vault has none.
+func (c *Config) homedir() string {
+	dir := c.Homedir
+	if dir == "" {
+		if !isDir(c.path(vaultKeyring)) && !isDir(c.path(keysDir)) {
+			return ""
+		}
+		dir = vaultKeyring
+	}
+	if !filepath.IsAbs(dir) {
+		dir = c.path(dir)
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir
+}
+
+func isDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+// findFile returns the path of the vault file name in either format, the
+// most recently written if both exist, or "" if neither does.
+func (c *Config) findFile(name string) string {
+	var found string
+	var modTime time.Time
+	for _, ext := range []string{binaryExt, armorExt, ageExt} {
+		fi, err := os.Stat(c.path(name + ext))
+		if err != nil {
+			continue
+		}
+		if found == "" || fi.ModTime().After(modTime) {
+			found, modTime = c.path(name+ext), fi.ModTime()
+		}
+	}
+	return found
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[1:])
+	}
+	return path
+}
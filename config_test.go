@@ -0,0 +1,48 @@
+package ponder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigTrustedWriters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ponder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ponderrc")
+
+	tests := []struct {
+		value string
+		want  []string
+		err   string
+	}{
+		{value: "AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB", want: []string{"AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB"}},
+		{value: "ae1d8d63dfefb677e3896be47e969ceaa8e9b1fb, 0E06D6CDB03A6D1EBD86BA4DFFF2B806FCC32F7B", want: []string{"ae1d8d63dfefb677e3896be47e969ceaa8e9b1fb", "0E06D6CDB03A6D1EBD86BA4DFFF2B806FCC32F7B"}},
+		{value: "alice@example.com", err: `"alice@example.com" is not a key fingerprint`},
+		{value: "7E969CEAA8E9B1FB", err: `"7E969CEAA8E9B1FB" is not a key fingerprint`},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(path, []byte("trusted-writers = "+tt.value+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		c, err := LoadConfig(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %s", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.value, err)
+			continue
+		}
+		if !equalStrings(c.TrustedWriters, tt.want) {
+			t.Errorf("%s: TrustedWriters = %q, want %q", tt.value, c.TrustedWriters, tt.want)
+		}
+	}
+}
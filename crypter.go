@@ -0,0 +1,145 @@
+package ponder
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Crypter is an OpenPGP implementation vault files are encrypted, decrypted,
+// signed and verified with. Backends register themselves by name; the
+// backend used is chosen by Config.Backend.
+type Crypter interface {
+	// Keys returns the keys in the keyring, only those with a secret part
+	// when secret is set.
+	Keys(secret bool) ([]*Key, error)
+
+	// Encrypt writes the contents of r to w encrypted to recipients, ASCII
+	// armored if armor is set.
+	Encrypt(w io.Writer, r io.Reader, recipients []*Key, armor bool) error
+
+	// Decrypt returns the contents of the message read from r, binary or
+	// ASCII armored, decrypted with a secret key in the keyring.
+	Decrypt(r io.Reader) ([]byte, error)
+
+	// Sign returns the contents of r as a signed message.
+	Sign(r io.Reader, signer *Key) ([]byte, error)
+
+	// Verify returns the contents of the signed message msg and its
+	// signatures. It fails if msg is not a signed message.
+	Verify(msg []byte) ([]byte, []Signature, error)
+}
+
+// Key is a public key in a Crypter's keyring.
+type Key struct {
+	UserIDs []UserID // the key's valid user IDs, primary first
+	SubKeys []SubKey // the primary key first
+
+	Revoked    bool
+	Expired    bool
+	Disabled   bool
+	Invalid    bool
+	CanEncrypt bool
+	CanSign    bool
+
+	native interface{} // the backend's own representation of the key
+}
+
+// UserID is a user ID of a key.
+type UserID struct {
+	Email    string
+	Validity Validity
+}
+
+// SubKey is the primary key or a subkey of a key.
+type SubKey struct {
+	Fingerprint string // upper case hex without spaces
+	KeyID       string
+}
+
+// Fingerprint returns the fingerprint of the primary key.
+func (k *Key) Fingerprint() string {
+	if len(k.SubKeys) == 0 {
+		return ""
+	}
+	return k.SubKeys[0].Fingerprint
+}
+
+// Email returns the email of the primary user ID.
+func (k *Key) Email() string {
+	if len(k.UserIDs) == 0 {
+		return ""
+	}
+	return k.UserIDs[0].Email
+}
+
+// Signature is a signature on a verified message.
+type Signature struct {
+	Fingerprint string // of the signing key or subkey
+	Err         error  // nil if the signature is good
+}
+
+// Validity is how far a keyring's web of trust is sure that a user ID
+// belongs to the owner of its key, in increasing order.
+type Validity int
+
+const (
+	ValidityUnknown Validity = iota
+	ValidityUndefined
+	ValidityNever
+	ValidityMarginal
+	ValidityFull
+	ValidityUltimate
+)
+
+// backends maps backend names to the functions opening them.
+var backends = make(map[string]func(conf *Config) (Crypter, error))
+
+func registerBackend(name string, open func(conf *Config) (Crypter, error)) {
+	backends[name] = open
+}
+
+// Backends returns the names of the backends compiled in.
+func Backends() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defaultBackend is the backend used when Config.Backend is empty: gpgme
+// when it is compiled in, the pure Go openpgp backend otherwise.
+func defaultBackend() string {
+	if _, ok := backends["gpgme"]; ok {
+		return "gpgme"
+	}
+	return "openpgp"
+}
+
+// backend returns the name of the backend used with c.
+func (c *Config) backend() string {
+	if c.Backend == "" {
+		return defaultBackend()
+	}
+	return c.Backend
+}
+
+// crypter returns the Crypter for c.Backend, opening it on first use.
+func (c *Config) crypter() (Crypter, error) {
+	if c.crypt != nil {
+		return c.crypt, nil
+	}
+	name := c.backend()
+	open, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+	crypt, err := open(c)
+	if err != nil {
+		return nil, err
+	}
+	c.crypt = crypt
+	return crypt, nil
+}
@@ -0,0 +1,113 @@
+package ponder
+
+import (
+	"fmt"
+
+	"github.com/go-ini/ini"
+)
+
+// Change is a difference between two versions of a vault.
+type Change struct {
+	Op       byte   // '+' added, '-' removed or '~' changed
+	Section  string // the section added, removed or holding the key
+	Key      string // the key added, removed or changed, "" for a section
+	Old, New string // the key's values
+}
+
+// masked replaces secret values in changes that do not show values.
+const masked = "********"
+
+// Format returns c as a line of a diff. The values of keys in sections
+// holding secrets are masked unless showValues is set; those of ACCESS,
+// GROUPS and SETTINGS are always shown.
+func (c Change) Format(showValues bool) string {
+	if c.Key == "" {
+		return fmt.Sprintf("%c [%s]", c.Op, c.Section)
+	}
+	old, new := c.Old, c.New
+	if !showValues && !publicSection(c.Section) {
+		old, new = masked, masked
+	}
+	switch c.Op {
+	case '+':
+		return fmt.Sprintf("+ [%s] %s = %s", c.Section, c.Key, new)
+	case '-':
+		return fmt.Sprintf("- [%s] %s = %s", c.Section, c.Key, old)
+	}
+	if old == new {
+		return fmt.Sprintf("~ [%s] %s", c.Section, c.Key)
+	}
+	return fmt.Sprintf("~ [%s] %s: %s -> %s", c.Section, c.Key, old, new)
+}
+
+// publicSection reports whether section holds only metadata, whose values
+// are shown in diffs. The default section may hold secrets like any other.
+func publicSection(section string) bool {
+	return section == "ACCESS" || section == "GROUPS" || section == "SETTINGS"
+}
+
+// Diff returns the sections and keys added, removed and changed from old
+// to new, in the order they appear in new followed by those removed.
+// Comments and ordering are ignored. A nil old is an empty vault.
+func Diff(old, new *Vault) []Change {
+	oldValues := make(map[string]map[string]string)
+	var oldSections []string
+	if old != nil {
+		oldValues, oldSections = old.values()
+	}
+	newValues, newSections := new.values()
+
+	var changes []Change
+	for _, name := range newSections {
+		before, ok := oldValues[name]
+		if !ok {
+			changes = append(changes, Change{Op: '+', Section: name})
+		}
+		for _, key := range new.cfg.Section(name).KeyStrings() {
+			value := newValues[name][key]
+			if was, ok := before[key]; !ok {
+				changes = append(changes, Change{Op: '+', Section: name, Key: key, New: value})
+			} else if was != value {
+				changes = append(changes, Change{Op: '~', Section: name, Key: key, Old: was, New: value})
+			}
+		}
+		if !ok {
+			continue
+		}
+		for _, key := range old.cfg.Section(name).KeyStrings() {
+			if _, ok := newValues[name][key]; !ok {
+				changes = append(changes, Change{Op: '-', Section: name, Key: key, Old: before[key]})
+			}
+		}
+	}
+	for _, name := range oldSections {
+		if _, ok := newValues[name]; ok {
+			continue
+		}
+		changes = append(changes, Change{Op: '-', Section: name})
+		for _, key := range old.cfg.Section(name).KeyStrings() {
+			changes = append(changes, Change{Op: '-', Section: name, Key: key, Old: oldValues[name][key]})
+		}
+	}
+	return changes
+}
+
+// values returns the values of every key by section, and the section
+// names in order. The empty default section is left out.
+func (v *Vault) values() (map[string]map[string]string, []string) {
+	values := make(map[string]map[string]string)
+	var names []string
+	for _, sec := range v.cfg.Sections() {
+		keys := sec.Keys()
+		if len(keys) == 0 && sec.Name() == ini.DEFAULT_SECTION {
+			continue
+		}
+		m := make(map[string]string)
+		for _, k := range keys {
+			m[k.Name()] = k.Value()
+		}
+		values[sec.Name()] = m
+		names = append(names, sec.Name())
+	}
+	return values, names
+}
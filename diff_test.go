@@ -0,0 +1,60 @@
+package ponder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+func TestDiff(t *testing.T) {
+	old, err := Parse(&Config{}, []byte("top = 1\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\nuser = admin\n[db]\npassword = b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	new, err := Parse(&Config{}, []byte("; a comment\ntop = 2\n[ACCESS]\nalice@example.com = *\nbob@example.com = web\n[web]\npassword = z\n[mail]\npassword = c\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Op: '~', Section: ini.DEFAULT_SECTION, Key: "top", Old: "1", New: "2"},
+		{Op: '+', Section: "ACCESS", Key: "bob@example.com", New: "web"},
+		{Op: '~', Section: "web", Key: "password", Old: "a", New: "z"},
+		{Op: '-', Section: "web", Key: "user", Old: "admin"},
+		{Op: '+', Section: "mail"},
+		{Op: '+', Section: "mail", Key: "password", New: "c"},
+		{Op: '-', Section: "db"},
+		{Op: '-', Section: "db", Key: "password", Old: "b"},
+	}
+	if got := Diff(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+	if got := Diff(old, old); len(got) != 0 {
+		t.Errorf("Diff() of a vault with itself = %+v, want none", got)
+	}
+}
+
+func TestChangeFormat(t *testing.T) {
+	tests := []struct {
+		change     Change
+		showValues bool
+		want       string
+	}{
+		{Change{Op: '+', Section: "web"}, false, "+ [web]"},
+		{Change{Op: '+', Section: "web", Key: "password", New: "s3cr3t"}, false, "+ [web] password = ********"},
+		{Change{Op: '+', Section: "web", Key: "password", New: "s3cr3t"}, true, "+ [web] password = s3cr3t"},
+		{Change{Op: '-', Section: "web", Key: "password", Old: "s3cr3t"}, false, "- [web] password = ********"},
+		{Change{Op: '~', Section: "web", Key: "password", Old: "a", New: "b"}, false, "~ [web] password"},
+		{Change{Op: '~', Section: "web", Key: "password", Old: "a", New: "b"}, true, "~ [web] password: a -> b"},
+		{Change{Op: '~', Section: ini.DEFAULT_SECTION, Key: "token", Old: "a", New: "b"}, false, "~ [DEFAULT] token"},
+		{Change{Op: '+', Section: ini.DEFAULT_SECTION, Key: "token", New: "s3cr3t"}, false, "+ [DEFAULT] token = ********"},
+		{Change{Op: '+', Section: "ACCESS", Key: "bob@example.com", New: "web"}, false, "+ [ACCESS] bob@example.com = web"},
+		{Change{Op: '~', Section: "GROUPS", Key: "@ops", Old: "alice@example.com", New: "bob@example.com"}, false, "~ [GROUPS] @ops: alice@example.com -> bob@example.com"},
+		{Change{Op: '-', Section: "SETTINGS", Key: "metadata", Old: "none"}, false, "- [SETTINGS] metadata = none"},
+	}
+	for _, tt := range tests {
+		if got := tt.change.Format(tt.showValues); got != tt.want {
+			t.Errorf("%+v.Format(%v) = %q, want %q", tt.change, tt.showValues, got, tt.want)
+		}
+	}
+}
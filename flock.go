@@ -0,0 +1,23 @@
+//go:build !windows
+// +build !windows
+
+package ponder
+
+import (
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock on f without blocking, and reports
+// whether it got it.
+func tryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,103 @@
+package ponder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// vaultFiles are git pathspecs matching the vault files in the vault
+// directory, but not in its subdirectories.
+var vaultFiles = []string{":(glob)*" + binaryExt, ":(glob)*" + armorExt, ":(glob)*" + ageExt}
+
+// commit commits the vault files written by saving v, with a message
+// naming the sections changed and the key they were signed with.
+func (v *Vault) commit(signer *Key) error {
+	// git add fails on pathspecs matching nothing, so name the files: those
+	// tracked, even if removed, and the new ones.
+	out, err := v.conf.git(nil, append([]string{"ls-files", "-z", "--cached", "--others", "--exclude-standard", "--"}, vaultFiles...)...)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	names := strings.Split(strings.TrimRight(string(out), "\x00"), "\x00")
+	if _, err := v.conf.git(nil, append([]string{"add", "--all", "--"}, names...)...); err != nil {
+		return err
+	}
+	subject := "Re-encrypt vault"
+	if sections := v.changedSections(); len(sections) > 0 {
+		subject = "Update " + strings.Join(sections, ", ")
+	}
+	msg := fmt.Sprintf("%s\n\nSaved by %s (%s).\n", subject, signer.Email(), signer.Fingerprint())
+	_, err = v.conf.git(nil, append([]string{"commit", "--quiet", "--message", msg, "--"}, names...)...)
+	return err
+}
+
+// changedSections returns the names of the sections changed since v was
+// opened, or every section of a vault that was not read from disk.
+func (v *Vault) changedSections() []string {
+	var base *Vault
+	if v.base != nil {
+		base, _ = Parse(v.conf, v.base)
+	}
+	var names []string
+	for _, c := range Diff(base, v) {
+		if !inSlice(c.Section, names) {
+			names = append(names, c.Section)
+		}
+	}
+	return names
+}
+
+// Log writes the history of the vault files, newest first, to w. The vault
+// directory must be in a git repository. A nil conf loads the default
+// config.
+func Log(conf *Config, w io.Writer) error {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"log", "--date=short", "--format=%h %ad %an%n    %s%n%w(0,4,4)%b", "--"}, vaultFiles...)
+	_, err = conf.git(w, args...)
+	return err
+}
+
+// Sync pulls the vault repository, rebasing any local commits on the
+// upstream ones, and writes git's output to w. A nil conf loads the
+// default config.
+func Sync(conf *Config, w io.Writer) error {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return err
+	}
+	_, err = conf.git(w, "pull", "--rebase")
+	return err
+}
+
+// git runs git in the vault directory and returns its output, or writes
+// it to w if w is not nil.
+func (c *Config) git(w io.Writer, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = c.Dir
+	out := new(bytes.Buffer)
+	cmd.Stdout = out
+	if w != nil {
+		cmd.Stdout = w
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	if w != nil {
+		cmd.Stderr = w
+	}
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,261 @@
+//go:build cgo && !nogpgme
+// +build cgo,!nogpgme
+
+package ponder
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/proglottis/gpgme"
+)
+
+func init() {
+	registerBackend("gpgme", openGPGME)
+}
+
+// gpgmeCrypter uses GnuPG through libgpgme. Secret keys always come from
+// the user's own keyring. Public keys come from the vault keyring when
+// there is one, and are then trusted for being in it.
+type gpgmeCrypter struct {
+	home   string // the vault keyring's GnuPG home, "" for none
+	engine string // the gpg binary
+
+	userHome    string // $GNUPGHOME as ponder found it
+	hasUserHome bool
+}
+
+func openGPGME(conf *Config) (Crypter, error) {
+	c := &gpgmeCrypter{home: conf.homedir()}
+	if c.home == "" {
+		return c, nil
+	}
+	if !isDir(c.home) {
+		// A vault with only a keys directory gets its keyring on first
+		// use.
+		if err := conf.syncKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	info, err := gpgme.GetEngineInfo()
+	if err != nil {
+		return nil, err
+	}
+	for ; info != nil; info = info.Next() {
+		if info.Protocol() == gpgme.ProtocolOpenPGP {
+			c.engine = info.FileName()
+		}
+	}
+	c.userHome, c.hasUserHome = os.LookupEnv("GNUPGHOME")
+	return c, nil
+}
+
+// use makes the following operations use the keyring in home, or the
+// user's own keyring when home is empty.
+func (c *gpgmeCrypter) use(home string) error {
+	if c.home == "" {
+		return nil
+	}
+	if err := gpgme.SetEngineInfo(gpgme.ProtocolOpenPGP, c.engine, home); err != nil {
+		return err
+	}
+	// The gpgme wrapper never passes homeDir on, so gpg has to find its
+	// home through the environment.
+	switch {
+	case home != "":
+		return os.Setenv("GNUPGHOME", home)
+	case c.hasUserHome:
+		return os.Setenv("GNUPGHOME", c.userHome)
+	default:
+		return os.Unsetenv("GNUPGHOME")
+	}
+}
+
+func (c *gpgmeCrypter) Keys(secret bool) ([]*Key, error) {
+	home := c.home
+	if secret {
+		home = ""
+	}
+	if err := c.use(home); err != nil {
+		return nil, err
+	}
+	keys, err := gpgme.FindKeys("", secret)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Key, len(keys))
+	for i, key := range keys {
+		list[i] = gpgmeKey(key)
+		if home != "" {
+			trustKey(list[i])
+		}
+	}
+	return list, nil
+}
+
+// trustKey gives every user ID of key at least full validity.
+func trustKey(key *Key) {
+	for i := range key.UserIDs {
+		if key.UserIDs[i].Validity < ValidityFull {
+			key.UserIDs[i].Validity = ValidityFull
+		}
+	}
+}
+
+var gpgmeValidity = map[gpgme.Validity]Validity{
+	gpgme.ValidityUnknown:   ValidityUnknown,
+	gpgme.ValidityUndefined: ValidityUndefined,
+	gpgme.ValidityNever:     ValidityNever,
+	gpgme.ValidityMarginal:  ValidityMarginal,
+	gpgme.ValidityFull:      ValidityFull,
+	gpgme.ValidityUltimate:  ValidityUltimate,
+}
+
+func gpgmeKey(key *gpgme.Key) *Key {
+	k := &Key{
+		Revoked:    key.Revoked(),
+		Expired:    key.Expired(),
+		Disabled:   key.Disabled(),
+		Invalid:    key.Invalid(),
+		CanEncrypt: key.CanEncrypt(),
+		CanSign:    key.CanSign(),
+		native:     key,
+	}
+	for uid := key.UserIDs(); uid != nil; uid = uid.Next() {
+		if uid.Revoked() || uid.Invalid() {
+			continue
+		}
+		k.UserIDs = append(k.UserIDs, UserID{Email: uid.Email(), Validity: gpgmeValidity[uid.Validity()]})
+	}
+	for sk := key.SubKeys(); sk != nil; sk = sk.Next() {
+		k.SubKeys = append(k.SubKeys, SubKey{
+			Fingerprint: sk.Fingerprint(),
+			KeyID:       sk.KeyID(),
+		})
+	}
+	return k
+}
+
+func nativeKeys(keys []*Key) []*gpgme.Key {
+	list := make([]*gpgme.Key, len(keys))
+	for i, key := range keys {
+		list[i] = key.native.(*gpgme.Key)
+	}
+	return list
+}
+
+func (c *gpgmeCrypter) Encrypt(w io.Writer, r io.Reader, recipients []*Key, armor bool) error {
+	if err := c.use(c.home); err != nil {
+		return err
+	}
+
+	cipher, err := gpgme.NewDataWriter(w)
+	if err != nil {
+		return err
+	}
+	defer cipher.Close()
+
+	plain, err := gpgme.NewDataReader(r)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	ctx, err := gpgme.New()
+	if err != nil {
+		return err
+	}
+	defer ctx.Release()
+
+	var flags gpgme.EncryptFlag
+	if c.home != "" {
+		flags = gpgme.EncryptAlwaysTrust
+	}
+	ctx.SetArmor(armor)
+	return ctx.Encrypt(nativeKeys(recipients), flags, plain, cipher)
+}
+
+func (c *gpgmeCrypter) Decrypt(r io.Reader) ([]byte, error) {
+	if err := c.use(""); err != nil {
+		return nil, err
+	}
+
+	plain, err := gpgme.Decrypt(r)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+
+	msg := new(bytes.Buffer)
+	if _, err := msg.ReadFrom(plain); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+func (c *gpgmeCrypter) Sign(r io.Reader, signer *Key) ([]byte, error) {
+	if err := c.use(""); err != nil {
+		return nil, err
+	}
+
+	ctx, err := gpgme.New()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Release()
+
+	plain, err := gpgme.NewDataReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+
+	signed := new(bytes.Buffer)
+	sig, err := gpgme.NewDataWriter(signed)
+	if err != nil {
+		return nil, err
+	}
+	defer sig.Close()
+
+	if err := ctx.Sign(nativeKeys([]*Key{signer}), plain, sig, gpgme.SigModeNormal); err != nil {
+		return nil, err
+	}
+	return signed.Bytes(), nil
+}
+
+func (c *gpgmeCrypter) Verify(msg []byte) ([]byte, []Signature, error) {
+	if err := c.use(c.home); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err := gpgme.New()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ctx.Release()
+
+	sig, err := gpgme.NewDataReader(bytes.NewReader(msg))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sig.Close()
+
+	buf := new(bytes.Buffer)
+	plain, err := gpgme.NewDataWriter(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer plain.Close()
+
+	_, sigs, err := ctx.Verify(sig, nil, plain)
+	if err != nil {
+		return nil, nil, err
+	}
+	list := make([]Signature, len(sigs))
+	for i, s := range sigs {
+		list[i] = Signature{Fingerprint: s.Fingerprint, Err: s.Status}
+	}
+	return buf.Bytes(), list, nil
+}
@@ -0,0 +1,365 @@
+package ponder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const keyringIgnore = `S.*
+*~
+*.lock
+.#*
+random_seed
+private-keys-v1.d/
+`
+
+// keysDir is the directory of the vault holding the armored public keys
+// of the team, one <fingerprint>.asc file per key.
+const keysDir = "keys"
+
+var (
+	ErrSecretKey = errors.New("refusing to add a secret key to the vault")
+	ErrKeysDir   = errors.New("the vault keeps its keys in the keys directory, use ponder keys add")
+)
+
+// TeamKey is a public key in the keys directory of a vault.
+type TeamKey struct {
+	Fingerprint string
+	UserIDs     []string
+
+	file string // the file in the keys directory holding the key
+}
+
+// ImportKeys imports the public keys read from r into the vault keyring,
+// creating the keyring in conf.Dir/.ponder/keyring if the vault has none.
+// It fails with ErrKeysDir if the vault has a keys directory, since the
+// vault keyring is synced with it before each save. It needs gpg in
+// $PATH. A nil conf loads the default config.
+func ImportKeys(conf *Config, r io.Reader) error {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return err
+	}
+	if files, err := conf.keyFiles(); err != nil {
+		return err
+	} else if files != nil {
+		return ErrKeysDir
+	}
+	home, err := conf.makeKeyring()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("gpg", "--homedir", home, "--batch", "--import")
+	cmd.Stdin = r
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// AddKeys adds the public keys read from r to the keys directory of the
+// vault, and imports them into the vault keyring. It returns the keys
+// added. A nil conf loads the default config.
+func AddKeys(conf *Config, r io.Reader) ([]TeamKey, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	home, err := conf.makeKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := gpg(home, bytes.NewReader(data), "--with-colons", "--import-options", "show-only", "--import")
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(out, []byte("sec:")) || bytes.Contains(out, []byte("\nsec:")) {
+		return nil, ErrSecretKey
+	}
+	keys := parseColons(out)
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if _, err := gpg(home, bytes.NewReader(data), "--quiet", "--import"); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(conf.path(keysDir), 0755); err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		armored, err := gpg(home, nil, "--armor", "--export", key.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(conf.keyFile(key.Fingerprint), armored, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// RemoveKeys removes the keys matching user, a fingerprint or email, from
+// the keys directory and the vault keyring. It returns the keys removed.
+// A nil conf loads the default config.
+func RemoveKeys(conf *Config, user string) ([]TeamKey, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ListKeys(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		for _, other := range keys {
+			if key.matches(user) && !other.matches(user) && other.file == key.file {
+				return nil, fmt.Errorf("%s also holds %s", key.file, other.Fingerprint)
+			}
+		}
+	}
+
+	var removed []TeamKey
+	for _, key := range keys {
+		if !key.matches(user) {
+			continue
+		}
+		if err := os.Remove(key.file); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		// The keyring only holds the key if it was synced since it was
+		// added.
+		if home := conf.homedir(); home != "" && inKeyring(home, key.Fingerprint) {
+			if _, err := gpg(home, nil, "--yes", "--delete-keys", key.Fingerprint); err != nil {
+				return removed, err
+			}
+		}
+		removed = append(removed, key)
+	}
+	if len(removed) == 0 {
+		return nil, errNoKey
+	}
+	return removed, nil
+}
+
+// ListKeys returns the keys in the keys directory of the vault, sorted by
+// fingerprint. A nil conf loads the default config.
+func ListKeys(conf *Config) ([]TeamKey, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	files, err := conf.keyFiles()
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	home, err := conf.makeKeyring()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := readKeyFiles(home, files)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Fingerprint < keys[j].Fingerprint })
+	return keys, nil
+}
+
+// readKeyFiles returns the keys in files, whatever the files are named,
+// using gpg on the keyring in home.
+func readKeyFiles(home string, files map[string]string) ([]TeamKey, error) {
+	var keys []TeamKey
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		out, err := gpg(home, f, "--with-colons", "--import-options", "show-only", "--import")
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, key := range parseColons(out) {
+			key.file = name
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// matches reports whether user is the fingerprint or an email of k.
+func (k TeamKey) matches(user string) bool {
+	if normFingerprint(user) == k.Fingerprint {
+		return true
+	}
+	for _, uid := range k.UserIDs {
+		if strings.HasSuffix(strings.ToLower(uid), "<"+strings.ToLower(user)+">") {
+			return true
+		}
+	}
+	return false
+}
+
+// syncKeys makes the vault keyring hold exactly the keys in the keys
+// directory, when the vault has one, so that every writer encrypts to the
+// same keys.
+func (c *Config) syncKeys() error {
+	files, err := c.keyFiles()
+	if err != nil || files == nil {
+		return err
+	}
+	home, err := c.makeKeyring()
+	if err != nil {
+		return err
+	}
+
+	var readers []io.Reader
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	if len(readers) > 0 {
+		if _, err := gpg(home, io.MultiReader(readers...), "--quiet", "--import"); err != nil {
+			return err
+		}
+	}
+
+	// Keep the keys the files hold, not the ones their names claim.
+	team, err := readKeyFiles(home, files)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool)
+	for _, key := range team {
+		keep[key.Fingerprint] = true
+	}
+	out, err := gpg(home, nil, "--with-colons", "--list-keys")
+	if err != nil {
+		return err
+	}
+	for _, key := range parseColons(out) {
+		if keep[key.Fingerprint] {
+			continue
+		}
+		if _, err := gpg(home, nil, "--yes", "--delete-keys", key.Fingerprint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inKeyring reports whether the keyring in home holds the key with
+// fingerprint fpr.
+func inKeyring(home, fpr string) bool {
+	_, err := gpg(home, nil, "--list-keys", fpr)
+	return err == nil
+}
+
+// keyFiles maps the name, without extension, of every file in the keys
+// directory to its path. Files are named after the fingerprint of the key
+// they hold, but the name is not trusted. It returns nil if the vault has
+// no keys directory.
+func (c *Config) keyFiles() (map[string]string, error) {
+	if _, err := os.Stat(c.path(keysDir)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	names, err := filepath.Glob(c.path(filepath.Join(keysDir, "*.asc")))
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]string)
+	for _, name := range names {
+		files[normFingerprint(strings.TrimSuffix(filepath.Base(name), ".asc"))] = name
+	}
+	return files, nil
+}
+
+// keyFile returns the name of the file in the keys directory for the key
+// with fingerprint fpr.
+func (c *Config) keyFile(fpr string) string {
+	return c.path(filepath.Join(keysDir, fpr+".asc"))
+}
+
+// makeKeyring returns the GnuPG home of the vault keyring, creating it in
+// Dir/.ponder/keyring if the vault has none.
+func (c *Config) makeKeyring() (string, error) {
+	home := c.homedir()
+	if home == "" {
+		var err error
+		if home, err = filepath.Abs(c.path(vaultKeyring)); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", err
+	}
+	// Keep gpg's sockets, backups and seed out of the vault repository.
+	ignore := filepath.Join(home, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(ignore, []byte(keyringIgnore), 0644); err != nil {
+			return "", err
+		}
+	}
+	return home, nil
+}
+
+// gpg runs gpg on the keyring in home and returns its output.
+func gpg(home string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("gpg", append([]string{"--homedir", home, "--batch"}, args...)...)
+	cmd.Stdin = stdin
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// parseColons returns the keys in gpg --with-colons output.
+func parseColons(out []byte) []TeamKey {
+	var keys []TeamKey
+	inPrimary := false
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		fields := strings.Split(s.Text(), ":")
+		if len(fields) < 10 {
+			continue
+		}
+		switch fields[0] {
+		case "pub", "sec":
+			keys = append(keys, TeamKey{})
+			inPrimary = true
+		case "sub", "ssb":
+			inPrimary = false
+		case "fpr":
+			if inPrimary && len(keys) > 0 && keys[len(keys)-1].Fingerprint == "" {
+				keys[len(keys)-1].Fingerprint = fields[9]
+			}
+		case "uid":
+			if len(keys) > 0 {
+				keys[len(keys)-1].UserIDs = append(keys[len(keys)-1].UserIDs, fields[9])
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,221 @@
+package ponder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// findKey returns the keys in keylist matching user, a primary key
+// fingerprint, an age or SSH public key, or the email address of any of a
+// key's valid user IDs. Only a fingerprint or public key identifies a
+// single key: anyone who can write to the vault can add a key carrying
+// someone else's email to its keys directory.
+func findKey(user string, keylist []*Key) []*Key {
+	fpr := normFingerprint(user)
+	if isAgeRecipient(user) {
+		if key, err := ageKey(user); err == nil {
+			fpr = key.Fingerprint()
+		}
+	}
+	var userKey []*Key
+	for i := 0; i < len(keylist); i++ {
+		if fpr == keylist[i].Fingerprint() || matchUserID(user, keylist[i]) != nil {
+			userKey = append(userKey, keylist[i])
+		}
+	}
+	return userKey
+}
+
+// matchUserID returns the first valid user ID of key with user's email.
+func matchUserID(user string, key *Key) *UserID {
+	for i, uid := range key.UserIDs {
+		if strings.EqualFold(user, uid.Email) {
+			return &key.UserIDs[i]
+		}
+	}
+	return nil
+}
+
+// validity returns how far the keyring trusts that key belongs to user:
+// the validity of the matching user ID, or of the key's most valid user ID
+// when user is a fingerprint.
+func validity(user string, key *Key) Validity {
+	if uid := matchUserID(user, key); uid != nil {
+		return uid.Validity
+	}
+	best := ValidityUnknown
+	for _, uid := range key.UserIDs {
+		if uid.Validity > best {
+			best = uid.Validity
+		}
+	}
+	return best
+}
+
+var validityNames = map[Validity]string{
+	ValidityUnknown:   "unknown",
+	ValidityUndefined: "undefined",
+	ValidityNever:     "never",
+	ValidityMarginal:  "marginal",
+	ValidityFull:      "full",
+	ValidityUltimate:  "ultimate",
+}
+
+// ParseValidity parses a validity name as shown by gpg: unknown,
+// undefined, never, marginal, full or ultimate.
+func ParseValidity(name string) (Validity, error) {
+	for v, n := range validityNames {
+		if n == name {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown validity %q", name)
+}
+
+// MissingKey is a recipient that could not be encrypted to.
+type MissingKey struct {
+	User   string
+	Reason string
+}
+
+// MissingKeysError reports recipients skipped when saving a vault.
+type MissingKeysError struct {
+	Keys []MissingKey
+}
+
+func (e *MissingKeysError) Error() string {
+	lines := []string{"no usable key for some recipients:"}
+	for _, k := range e.Keys {
+		lines = append(lines, fmt.Sprintf("\t%s: %s", k.User, k.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var errNoKey = errors.New("no key found")
+
+// resolveKey returns the usable key in keylist for user whose validity is
+// at least min. It fails if several keys match, rather than guess which
+// one the user owns. Age and SSH public keys are used as they are.
+func resolveKey(user string, keylist []*Key, min Validity) (*Key, error) {
+	if isAgeRecipient(user) {
+		return ageKey(user)
+	}
+
+	candidates := findKey(user, keylist)
+	if len(candidates) == 0 {
+		return nil, errNoKey
+	}
+
+	var usable []*Key
+	var reasons []string
+	for _, key := range candidates {
+		if reason := unusable(key); reason != "" {
+			reasons = append(reasons, fmt.Sprintf("key %s is %s", key.Fingerprint(), reason))
+			continue
+		}
+		if v := validity(user, key); v < min {
+			reasons = append(reasons, fmt.Sprintf("key %s has %s validity, below %s", key.Fingerprint(), validityNames[v], validityNames[min]))
+			continue
+		}
+		usable = append(usable, key)
+	}
+	switch len(usable) {
+	case 0:
+		return nil, errors.New(strings.Join(reasons, ", "))
+	case 1:
+		return usable[0], nil
+	}
+	fprs := make([]string, len(usable))
+	for i, key := range usable {
+		fprs[i] = key.Fingerprint()
+	}
+	return nil, fmt.Errorf("keys %s all match, name one by fingerprint", strings.Join(fprs, ", "))
+}
+
+// unusable returns why key cannot be encrypted to, or "" if it can.
+func unusable(key *Key) string {
+	switch {
+	case key.Revoked:
+		return "revoked"
+	case key.Expired:
+		return "expired"
+	case key.Disabled:
+		return "disabled"
+	case key.Invalid:
+		return "invalid"
+	case !key.CanEncrypt:
+		return "not capable of encryption"
+	}
+	return ""
+}
+
+// isFingerprint reports whether s is a full OpenPGP v4 fingerprint.
+func isFingerprint(s string) bool {
+	s = normFingerprint(s)
+	if len(s) != 40 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789ABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// normFingerprint returns s in the form backends report fingerprints:
+// upper case hex without spaces.
+func normFingerprint(s string) string {
+	return strings.ToUpper(strings.Replace(s, " ", "", -1))
+}
+
+// keyName returns the name, without extension, of the vault file
+// encrypted for key.
+func keyName(key *Key) string {
+	if key.isAge() {
+		return ageName(key)
+	}
+	return key.Fingerprint()
+}
+
+// MigrateFilenames renames vault files in conf.Dir named after the short
+// key ID of a key in the keyring to its full fingerprint. It returns the
+// old names of the files renamed. A nil conf loads the default config.
+func MigrateFilenames(conf *Config) ([]string, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	crypt, err := conf.crypter()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := crypt.Keys(false)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := conf.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var renamed []string
+	for _, key := range keys {
+		oldName := conf.path(key.SubKeys[0].KeyID + binaryExt)
+		newName := conf.path(keyName(key) + binaryExt)
+		if _, err := os.Stat(oldName); err != nil {
+			continue
+		}
+		if conf.findFile(keyName(key)) != "" {
+			continue
+		}
+		if err := os.Rename(oldName, newName); err != nil {
+			return renamed, err
+		}
+		renamed = append(renamed, oldName)
+	}
+	return renamed, nil
+}
@@ -0,0 +1,46 @@
+package ponder
+
+import (
+	"strings"
+	"testing"
+)
+
+func testKey(fpr, email string) *Key {
+	return &Key{
+		UserIDs:    []UserID{{Email: email, Validity: ValidityFull}},
+		SubKeys:    []SubKey{{Fingerprint: fpr}},
+		CanEncrypt: true,
+	}
+}
+
+func TestResolveKey(t *testing.T) {
+	bob := testKey("0E06D6CDB03A6D1EBD86BA4DFFF2B806FCC32F7B", "bob@example.com")
+	planted := testKey("AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB", "bob@example.com")
+
+	if _, err := resolveKey("bob@example.com", []*Key{bob, planted}, ValidityFull); err == nil {
+		t.Errorf("resolved an email matching two keys")
+	} else if !strings.Contains(err.Error(), planted.Fingerprint()) {
+		t.Errorf("error %q does not name %s", err, planted.Fingerprint())
+	}
+
+	key, err := resolveKey(bob.Fingerprint(), []*Key{bob, planted}, ValidityFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != bob {
+		t.Errorf("fingerprint resolved to %s", key.Fingerprint())
+	}
+
+	planted.Expired = true
+	key, err = resolveKey("bob@example.com", []*Key{bob, planted}, ValidityFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != bob {
+		t.Errorf("email resolved to the expired key %s", key.Fingerprint())
+	}
+
+	if _, err := resolveKey("carol@example.com", []*Key{bob}, ValidityFull); err != errNoKey {
+		t.Errorf("got %v for a user without a key, want %v", err, errNoKey)
+	}
+}
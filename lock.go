@@ -0,0 +1,52 @@
+package ponder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockName is the lock file taken while the vault is written, relative to
+// the vault directory.
+const lockName = ".ponder/lock"
+
+// DefaultLockTimeout is how long saving waits by default for another
+// process to finish writing the vault.
+const DefaultLockTimeout = 10 * time.Second
+
+var ErrLocked = errors.New("the vault is being written by another process")
+
+// lock takes the vault's write lock, waiting up to c.LockTimeout for other
+// writers to release it, and returns the function releasing it.
+func (c *Config) lock() (func(), error) {
+	name := c.path(lockName)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(c.LockTimeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, ErrLocked
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
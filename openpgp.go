@@ -0,0 +1,357 @@
+package ponder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func init() {
+	registerBackend("openpgp", openOpenPGP)
+}
+
+// openpgpCrypter is a pure Go backend using the keys in an armored keyring
+// file, if it exists, and the public keys in the keys directory of the
+// vault. It supports RSA, DSA, ElGamal, ECDSA, ECDH and EdDSA keys,
+// including the Ed25519 and Cv25519 keys gpg creates by default. Every
+// user ID in the keyring has full validity, or ultimate validity when the
+// keyring holds the key's secret part: adding a key to the file is what
+// certifies it.
+type openpgpCrypter struct {
+	keyring    openpgp.EntityList
+	passphrase func(prompt string) ([]byte, error)
+}
+
+func openOpenPGP(conf *Config) (Crypter, error) {
+	if conf.Keyring == "" {
+		return nil, errors.New("openpgp backend: no keyring file configured")
+	}
+	files, err := conf.keyFiles()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{conf.Keyring}
+	for _, name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	c := &openpgpCrypter{passphrase: conf.Passphrase}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if os.IsNotExist(err) && name == conf.Keyring {
+			// Users reading the vault with age need no keyring.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		keyring, err := readArmoredKeyring(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		c.add(keyring)
+	}
+	return c, nil
+}
+
+// readArmoredKeyring reads every armored key block in data, as written by
+// gpg --export --armor and gpg --export-secret-keys --armor.
+func readArmoredKeyring(data []byte) (openpgp.EntityList, error) {
+	begin := []byte("-----BEGIN PGP")
+	var keyring openpgp.EntityList
+	for {
+		i := bytes.Index(data, begin)
+		if i < 0 {
+			break
+		}
+		data = data[i:]
+		block := data
+		if next := bytes.Index(data[len(begin):], begin); next >= 0 {
+			block, data = data[:len(begin)+next], data[len(begin)+next:]
+		} else {
+			data = nil
+		}
+
+		armored, err := armor.Decode(bytes.NewReader(block))
+		if err != nil {
+			return nil, err
+		}
+		entities, err := openpgp.ReadKeyRing(armored.Body)
+		if err != nil {
+			return nil, err
+		}
+		keyring = append(keyring, entities...)
+	}
+	if len(keyring) == 0 {
+		return nil, ErrNoKeys
+	}
+	return keyring, nil
+}
+
+// add adds entities to the keyring. When a key appears more than once the
+// copy holding the secret part wins.
+func (c *openpgpCrypter) add(entities openpgp.EntityList) {
+next:
+	for _, e := range entities {
+		for i, have := range c.keyring {
+			if bytes.Equal(have.PrimaryKey.Fingerprint, e.PrimaryKey.Fingerprint) {
+				if e.PrivateKey != nil {
+					c.keyring[i] = e
+				}
+				continue next
+			}
+		}
+		c.keyring = append(c.keyring, e)
+	}
+}
+
+func (c *openpgpCrypter) Keys(secret bool) ([]*Key, error) {
+	var keys []*Key
+	for _, e := range c.keyring {
+		if secret && e.PrivateKey == nil {
+			continue
+		}
+		keys = append(keys, openpgpKey(e))
+	}
+	return keys, nil
+}
+
+func openpgpKey(e *openpgp.Entity) *Key {
+	now := time.Now()
+	k := &Key{
+		Revoked: e.Revoked(now),
+		native:  e,
+	}
+
+	validity := ValidityFull
+	if e.PrivateKey != nil {
+		validity = ValidityUltimate
+	}
+	primary := primaryIdentity(e)
+	for _, id := range identities(e) {
+		if id.Revoked(now) {
+			continue
+		}
+		uid := UserID{Email: id.UserId.Email, Validity: validity}
+		if id == primary {
+			k.UserIDs = append([]UserID{uid}, k.UserIDs...)
+		} else {
+			k.UserIDs = append(k.UserIDs, uid)
+		}
+	}
+	if primary != nil {
+		k.Expired = e.PrimaryKey.KeyExpired(primary.SelfSignature, now)
+	}
+
+	k.SubKeys = append(k.SubKeys, SubKey{
+		Fingerprint: fmt.Sprintf("%X", e.PrimaryKey.Fingerprint),
+		KeyID:       e.PrimaryKey.KeyIdString(),
+	})
+	for _, sk := range e.Subkeys {
+		usable := !sk.Revoked(now) && !sk.PublicKey.KeyExpired(sk.Sig, now)
+		k.SubKeys = append(k.SubKeys, SubKey{
+			Fingerprint: fmt.Sprintf("%X", sk.PublicKey.Fingerprint),
+			KeyID:       sk.PublicKey.KeyIdString(),
+		})
+		if usable && sk.Sig.FlagsValid {
+			k.CanEncrypt = k.CanEncrypt || sk.Sig.FlagEncryptCommunications && sk.PublicKey.PubKeyAlgo.CanEncrypt()
+			k.CanSign = k.CanSign || sk.Sig.FlagSign && sk.PublicKey.PubKeyAlgo.CanSign()
+		}
+	}
+
+	// Like the openpgp package, treat a primary key without usage flags as
+	// good for everything.
+	if primary != nil && !k.CanEncrypt {
+		sig := primary.SelfSignature
+		k.CanEncrypt = !sig.FlagsValid || sig.FlagEncryptCommunications && e.PrimaryKey.PubKeyAlgo.CanEncrypt()
+	}
+	if primary != nil && !k.CanSign {
+		sig := primary.SelfSignature
+		k.CanSign = !sig.FlagsValid || sig.FlagSign
+	}
+	k.Invalid = primary == nil
+	return k
+}
+
+// identities returns the user IDs of e in a stable order.
+func identities(e *openpgp.Entity) []*openpgp.Identity {
+	var names []string
+	for name := range e.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make([]*openpgp.Identity, len(names))
+	for i, name := range names {
+		ids[i] = e.Identities[name]
+	}
+	return ids
+}
+
+// primaryIdentity returns the user ID of e marked as primary, or the first
+// one if none is.
+func primaryIdentity(e *openpgp.Entity) *openpgp.Identity {
+	ids := identities(e)
+	for _, id := range ids {
+		if id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return id
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids[0]
+}
+
+func entities(keys []*Key) []*openpgp.Entity {
+	list := make([]*openpgp.Entity, len(keys))
+	for i, key := range keys {
+		list[i] = key.native.(*openpgp.Entity)
+	}
+	return list
+}
+
+func (c *openpgpCrypter) Encrypt(w io.Writer, r io.Reader, recipients []*Key, armored bool) error {
+	if armored {
+		aw, err := armor.Encode(w, "PGP MESSAGE", nil)
+		if err != nil {
+			return err
+		}
+		if err := c.Encrypt(aw, r, recipients, false); err != nil {
+			return err
+		}
+		return aw.Close()
+	}
+
+	plain, err := openpgp.Encrypt(w, entities(recipients), nil, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(plain, r); err != nil {
+		return err
+	}
+	return plain.Close()
+}
+
+func (c *openpgpCrypter) Decrypt(r io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var cipher io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP MESSAGE")) {
+		block, err := armor.Decode(cipher)
+		if err != nil {
+			return nil, err
+		}
+		cipher = block.Body
+	}
+
+	md, err := openpgp.ReadMessage(cipher, c.keyring, c.prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(md.UnverifiedBody)
+}
+
+// prompt unlocks the secret keys the openpgp package asks for.
+func (c *openpgpCrypter) prompt(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+	for _, key := range keys {
+		if err := c.unlock(key.Entity); err != nil {
+			return nil, err
+		}
+		if !key.PrivateKey.Encrypted {
+			return nil, nil
+		}
+	}
+	return nil, errors.New("no secret key to decrypt with")
+}
+
+// unlock decrypts the passphrase protected secret parts of e.
+func (c *openpgpCrypter) unlock(e *openpgp.Entity) error {
+	locked := []*packet.PrivateKey{}
+	if e.PrivateKey != nil && e.PrivateKey.Encrypted {
+		locked = append(locked, e.PrivateKey)
+	}
+	for _, sk := range e.Subkeys {
+		if sk.PrivateKey != nil && sk.PrivateKey.Encrypted {
+			locked = append(locked, sk.PrivateKey)
+		}
+	}
+	if len(locked) == 0 {
+		return nil
+	}
+
+	key := openpgpKey(e)
+	if c.passphrase == nil {
+		return fmt.Errorf("secret key %s is passphrase protected", key.Fingerprint())
+	}
+	pass, err := c.passphrase(fmt.Sprintf("Passphrase for %s (%s): ", key.Email(), key.Fingerprint()))
+	if err != nil {
+		return err
+	}
+	for _, priv := range locked {
+		if err := priv.Decrypt(pass); err != nil {
+			return fmt.Errorf("secret key %s: %v", key.Fingerprint(), err)
+		}
+	}
+	return nil
+}
+
+func (c *openpgpCrypter) Sign(r io.Reader, signer *Key) ([]byte, error) {
+	e := signer.native.(*openpgp.Entity)
+	if err := c.unlock(e); err != nil {
+		return nil, err
+	}
+
+	signed := new(bytes.Buffer)
+	plain, err := openpgp.Sign(signed, e, &openpgp.FileHints{IsBinary: true}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(plain, r); err != nil {
+		return nil, err
+	}
+	if err := plain.Close(); err != nil {
+		return nil, err
+	}
+	return signed.Bytes(), nil
+}
+
+func (c *openpgpCrypter) Verify(msg []byte) ([]byte, []Signature, error) {
+	md, err := openpgp.ReadMessage(bytes.NewReader(msg), c.keyring, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if md.IsEncrypted {
+		return nil, nil, errors.New("message is encrypted, not signed")
+	}
+	plain, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !md.IsSigned {
+		return plain, nil, nil
+	}
+
+	if md.SignedBy == nil {
+		sig := Signature{
+			Fingerprint: fmt.Sprintf("%016X", md.SignedByKeyId),
+			Err:         errors.New("no public key"),
+		}
+		return plain, []Signature{sig}, nil
+	}
+	sig := Signature{
+		Fingerprint: fmt.Sprintf("%X", md.SignedBy.PublicKey.Fingerprint),
+		Err:         md.SignatureError,
+	}
+	return plain, []Signature{sig}, nil
+}
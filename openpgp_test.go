@@ -0,0 +1,224 @@
+package ponder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// newEntity returns a new Ed25519 and Cv25519 key for email, with its
+// secret part.
+func newEntity(t *testing.T, email string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(email, "", email, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// publicOnly returns a copy of e without its secret parts, as read from an
+// exported public key.
+func publicOnly(t *testing.T, e *openpgp.Entity) *openpgp.Entity {
+	buf := new(bytes.Buffer)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := readArmoredKeyring(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring[0]
+}
+
+func TestOpenPGPKey(t *testing.T) {
+	alice := newEntity(t, "alice@example.com")
+	key := openpgpKey(alice)
+	if key.Email() != "alice@example.com" {
+		t.Errorf("Email() = %q, want alice@example.com", key.Email())
+	}
+	if want := strings.ToUpper(alice.PrimaryKey.KeyIdString()); !strings.HasSuffix(key.Fingerprint(), want) {
+		t.Errorf("Fingerprint() = %s, want it to end in the key ID %s", key.Fingerprint(), want)
+	}
+	if !key.CanEncrypt || !key.CanSign || unusable(key) != "" {
+		t.Errorf("key cannot be used: %+v", key)
+	}
+	if v := key.UserIDs[0].Validity; v != ValidityUltimate {
+		t.Errorf("secret key validity = %s, want ultimate", validityNames[v])
+	}
+
+	pub := openpgpKey(publicOnly(t, alice))
+	if pub.Fingerprint() != key.Fingerprint() {
+		t.Errorf("public key fingerprint = %s, want %s", pub.Fingerprint(), key.Fingerprint())
+	}
+	if v := pub.UserIDs[0].Validity; v != ValidityFull {
+		t.Errorf("public key validity = %s, want full", validityNames[v])
+	}
+}
+
+func TestOpenPGPEncryptDecrypt(t *testing.T) {
+	alice, bob := newEntity(t, "alice@example.com"), newEntity(t, "bob@example.com")
+	c := &openpgpCrypter{}
+	c.add(openpgp.EntityList{alice, publicOnly(t, bob)})
+	keys, err := c.Keys(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+	if secret, _ := c.Keys(true); len(secret) != 1 || secret[0].Email() != "alice@example.com" {
+		t.Errorf("secret keys = %v, want alice's", secret)
+	}
+
+	plain := "[ACCESS]\nalice@example.com = *\n"
+	for _, armored := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		if err := c.Encrypt(buf, strings.NewReader(plain), keys, armored); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.HasPrefix(buf.Bytes(), []byte("-----BEGIN PGP MESSAGE")); got != armored {
+			t.Errorf("armored = %v, but output armored is %v", armored, got)
+		}
+		out, err := c.Decrypt(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != plain {
+			t.Errorf("Decrypt() = %q, want %q", out, plain)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := c.Encrypt(buf, strings.NewReader(plain), keys[1:], false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Decrypt(buf); err == nil {
+		t.Errorf("decrypted a message encrypted only to bob")
+	}
+}
+
+func TestOpenPGPPassphrase(t *testing.T) {
+	alice := newEntity(t, "alice@example.com")
+	if err := alice.EncryptPrivateKeys([]byte("pw-alice"), nil); err != nil {
+		t.Fatal(err)
+	}
+	c := &openpgpCrypter{}
+	c.add(openpgp.EntityList{alice})
+	keys, _ := c.Keys(true)
+
+	buf := new(bytes.Buffer)
+	if err := c.Encrypt(buf, strings.NewReader("secret"), keys, false); err != nil {
+		t.Fatal(err)
+	}
+	msg := buf.Bytes()
+	if _, err := c.Decrypt(bytes.NewReader(msg)); err == nil {
+		t.Errorf("decrypted with a locked key and no passphrase")
+	}
+
+	c.passphrase = func(prompt string) ([]byte, error) {
+		return []byte("pw-alice"), nil
+	}
+	out, err := c.Decrypt(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "secret" {
+		t.Errorf("Decrypt() = %q, want %q", out, "secret")
+	}
+}
+
+func TestOpenPGPSignVerify(t *testing.T) {
+	alice := newEntity(t, "alice@example.com")
+	c := &openpgpCrypter{}
+	c.add(openpgp.EntityList{alice})
+	key := openpgpKey(alice)
+
+	signed, err := c.Sign(strings.NewReader("plain"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, sigs, err := c.Verify(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != "plain" {
+		t.Errorf("Verify() = %q, want %q", plain, "plain")
+	}
+	if len(sigs) != 1 || sigs[0].Err != nil || !hasSubKey(key, sigs[0].Fingerprint) {
+		t.Errorf("signatures = %+v, want a good one by %s", sigs, key.Fingerprint())
+	}
+
+	// Without alice's key the signature cannot be checked.
+	_, sigs, err = (&openpgpCrypter{}).Verify(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 1 || sigs[0].Err == nil {
+		t.Errorf("signatures = %+v, want one without a public key", sigs)
+	}
+}
+
+func TestCheckSignatures(t *testing.T) {
+	alice, bob, carol := newEntity(t, "alice@example.com"), newEntity(t, "bob@example.com"), newEntity(t, "carol@example.com")
+	// Alice reads the vault; bob and carol wrote to it.
+	c := &openpgpCrypter{}
+	c.add(openpgp.EntityList{alice, publicOnly(t, bob), publicOnly(t, carol)})
+	bobKey := openpgpKey(bob)
+	conf := &Config{crypt: c, TrustedWriters: []string{bobKey.Fingerprint()}}
+
+	sign := func(e *openpgp.Entity) []Signature {
+		signer := &openpgpCrypter{}
+		signer.add(openpgp.EntityList{e})
+		signed, err := signer.Sign(strings.NewReader("plain"), openpgpKey(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sigs, err := c.Verify(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sigs
+	}
+
+	tests := []struct {
+		name   string
+		sigs   []Signature
+		reason string
+	}{
+		{"unsigned", nil, "file is not signed"},
+		{"own key", sign(alice), ""},
+		{"trusted writer", sign(bob), ""},
+		{"untrusted writer", sign(carol), "who is not a trusted writer"},
+		{"bad signature", []Signature{{Fingerprint: bobKey.Fingerprint(), Err: errNoKey}}, "bad signature by " + bobKey.Fingerprint()},
+	}
+	for _, tt := range tests {
+		reason, err := conf.checkSignatures(tt.sigs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.reason == "" && reason != "" || !strings.Contains(reason, tt.reason) {
+			t.Errorf("%s: checkSignatures() = %q, want %q", tt.name, reason, tt.reason)
+		}
+	}
+}
+
+// hasSubKey reports whether fpr is the fingerprint of key or a subkey.
+func hasSubKey(key *Key, fpr string) bool {
+	for _, sk := range key.SubKeys {
+		if sk.Fingerprint == fpr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package ponder
+
+import (
+	"fmt"
+
+	"github.com/go-ini/ini"
+)
+
+// The optional SETTINGS section of a vault configures who may see its
+// metadata, the ACCESS, GROUPS and SETTINGS sections:
+//
+//	[SETTINGS]
+//	admins   = @admin
+//	metadata = own
+//
+// admins lists the users and @groups that receive the full metadata and
+// the master copy of the vault, so each must be granted *. When it is not
+// set, every user granted * is an admin.
+//
+// metadata controls what everyone else receives: "own" (the default) copies
+// only the ACCESS entries that apply to the user, "none" copies no metadata
+// and "all" copies it in full.
+const (
+	MetadataOwn  = "own"
+	MetadataNone = "none"
+	MetadataAll  = "all"
+)
+
+// setting returns the value of key in the SETTINGS section.
+func (v *Vault) setting(key string) string {
+	sec, err := v.cfg.GetSection("SETTINGS")
+	if err != nil || !inSlice(key, sec.KeyStrings()) {
+		return ""
+	}
+	return sec.Key(key).Value()
+}
+
+// metadata returns the metadata policy for non-admin users.
+func (v *Vault) metadata() (string, error) {
+	switch m := v.setting("metadata"); m {
+	case "":
+		return MetadataOwn, nil
+	case MetadataOwn, MetadataNone, MetadataAll:
+		return m, nil
+	default:
+		return "", fmt.Errorf("SETTINGS: metadata: unknown policy %q", m)
+	}
+}
+
+// admins returns the set of users receiving the full vault metadata. It
+// fails if an admin listed in SETTINGS is not granted *, since the master
+// copy would give them every section anyway.
+func (v *Vault) admins(grants []grant) (map[string]bool, error) {
+	all := make(map[string]bool)
+	for _, g := range grants {
+		if g.access.All() {
+			all[g.user] = true
+		}
+	}
+	list := v.setting("admins")
+	if list == "" {
+		return all, nil
+	}
+
+	admins := make(map[string]bool)
+
+	for _, name := range splitMembers(list) {
+		users := []string{name}
+		if isGroup(name) {
+			var err error
+			if users, err = v.members(name); err != nil {
+				return nil, fmt.Errorf("SETTINGS: admins: %v", err)
+			}
+		}
+		for _, user := range users {
+			if !all[user] {
+				return nil, fmt.Errorf("SETTINGS: admins: %s is not granted * in ACCESS", user)
+			}
+			admins[user] = true
+		}
+	}
+	return admins, nil
+}
+
+// view builds the copy of the vault encrypted for g.
+func (v *Vault) view(g grant, admin bool, metadata string) (*ini.File, error) {
+	newCfg := ini.Empty()
+	for _, sec := range v.cfg.Sections() {
+		name := sec.Name()
+		switch {
+		case name == ini.DEFAULT_SECTION:
+			if !g.access.All() {
+				continue
+			}
+		case isMeta(name):
+			if !admin && metadata != MetadataAll {
+				if name == "ACCESS" && metadata == MetadataOwn {
+					if err := copyKeys(newCfg, sec, g.entries); err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+		case !g.access.Allows(name):
+			continue
+		}
+		if err := copySection(newCfg, sec); err != nil {
+			return nil, err
+		}
+	}
+	return newCfg, nil
+}
+
+// copyKeys copies sec with only the named keys into cfg.
+func copyKeys(cfg *ini.File, sec *ini.Section, keys []string) error {
+	newSec, err := cfg.NewSection(sec.Name())
+	if err != nil {
+		return err
+	}
+	for _, k := range sec.Keys() {
+		if !inSlice(k.Name(), keys) {
+			continue
+		}
+		newKey, err := newSec.NewKey(k.Name(), k.Value())
+		if err != nil {
+			return err
+		}
+		newKey.Comment = k.Comment
+	}
+	return nil
+}
+
+// Whoami describes what the key a vault was opened with can read.
+type Whoami struct {
+	Fingerprint string
+	Email       string
+	Admin       bool     // whether the key receives the full vault metadata
+	All         bool     // whether the key can read every section
+	Entries     []string // ACCESS entries naming the key, directly or via groups
+	Sections    []string // sections the key can read
+}
+
+// Whoami reports what the key the vault was opened with can read.
+func (v *Vault) Whoami() (*Whoami, error) {
+	if v.key == nil {
+		return nil, ErrNoIdentity
+	}
+	w := &Whoami{
+		Fingerprint: v.key.Fingerprint(),
+		Email:       v.key.Email(),
+	}
+
+	sec, err := v.cfg.GetSection("ACCESS")
+	if err != nil {
+		// Without ACCESS entries the vault holds exactly what the key
+		// may read.
+		for _, name := range v.Sections() {
+			if !isMeta(name) {
+				w.Sections = append(w.Sections, name)
+			}
+		}
+		return w, nil
+	}
+
+	// A user's own view lists the groups they belong to without the
+	// GROUPS section, so every group entry in it applies.
+	_, err = v.cfg.GetSection("GROUPS")
+	hasGroups := err == nil
+
+	var access accessList
+	for _, k := range sec.Keys() {
+		a, err := ParseAccess(k.Value())
+		if err != nil {
+			err.(*AccessError).User = k.Name()
+			return nil, err
+		}
+		users := []string{k.Name()}
+		if isGroup(k.Name()) && hasGroups {
+			if users, err = v.members(k.Name()); err != nil {
+				return nil, err
+			}
+		}
+		if (isGroup(k.Name()) && !hasGroups) || v.isKey(users...) {
+			w.Entries = append(w.Entries, k.Name())
+			access = append(access, a)
+		}
+	}
+
+	if grants, err := v.grants(); err == nil {
+		admins, err := v.admins(grants)
+		if err != nil {
+			return nil, err
+		}
+		for user := range admins {
+			w.Admin = w.Admin || v.isKey(user)
+		}
+	}
+
+	w.All = access.All()
+	for _, name := range v.Sections() {
+		if !isMeta(name) && access.Allows(name) {
+			w.Sections = append(w.Sections, name)
+		}
+	}
+	return w, nil
+}
+
+// isKey reports whether any of users names the key the vault was opened
+// with.
+func (v *Vault) isKey(users ...string) bool {
+	for _, user := range users {
+		if findKey(user, []*Key{v.key}) != nil {
+			return true
+		}
+	}
+	return false
+}
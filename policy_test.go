@@ -0,0 +1,178 @@
+package ponder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+const viewMaster = `; shared across every host
+top     = secret
+timeout = 30
+
+[ACCESS]
+alice@example.com = *
+bob@example.com   = myhost, !myhost.billing
+carol@example.com = db.*
+@ops              = web
+
+[GROUPS]
+ops = dave@example.com, erin@example.com
+
+; the main host
+[myhost]
+; login
+username = me
+password = xx
+port     = 22
+
+[myhost.prod]
+; production credentials
+password = yy
+url      = https://prod.example.com
+
+[myhost.billing]
+card = 4111
+
+[db]
+root = zz
+
+[db.replica]
+; read only
+user     = ro
+password = rr
+
+[web]
+password = ww
+`
+
+func TestViewRoundTrip(t *testing.T) {
+	v, err := Parse(&Config{}, []byte(viewMaster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants, err := v.grants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admins, err := v.admins(grants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"alice@example.com": {ini.DEFAULT_SECTION, "myhost", "myhost.prod", "myhost.billing", "db", "db.replica", "web"},
+		"bob@example.com":   {"myhost", "myhost.prod"},
+		"carol@example.com": {"db.replica"},
+		"dave@example.com":  {"web"},
+		"erin@example.com":  {"web"},
+	}
+	if len(grants) != len(want) {
+		t.Fatalf("got %d grants, want %d", len(grants), len(want))
+	}
+	for _, g := range grants {
+		cfg, err := v.view(g, admins[g.user], MetadataOwn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := cfg.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ini.Load(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: reparsing view: %v", g.user, err)
+		}
+
+		for _, name := range v.cfg.SectionStrings() {
+			if isMeta(name) && name != ini.DEFAULT_SECTION {
+				continue
+			}
+			allowed := inSlice(name, want[g.user])
+			sec, err := got.GetSection(name)
+			if !allowed {
+				if err == nil && len(sec.Keys()) > 0 {
+					t.Errorf("%s: view has section %q", g.user, name)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: view is missing section %q", g.user, name)
+				continue
+			}
+			compareSection(t, g.user, v.cfg.Section(name), sec)
+		}
+	}
+}
+
+// compareSection checks that got holds the keys of want, in order, with
+// the same values and comments.
+func compareSection(t *testing.T, user string, want, got *ini.Section) {
+	if want.Name() != ini.DEFAULT_SECTION && got.Comment != want.Comment {
+		t.Errorf("%s: [%s] comment = %q, want %q", user, want.Name(), got.Comment, want.Comment)
+	}
+	if !equalStrings(got.KeyStrings(), want.KeyStrings()) {
+		t.Errorf("%s: [%s] keys = %q, want %q", user, want.Name(), got.KeyStrings(), want.KeyStrings())
+		return
+	}
+	for _, k := range want.Keys() {
+		gk := got.Key(k.Name())
+		if gk.Value() != k.Value() {
+			t.Errorf("%s: [%s] %s = %q, want %q", user, want.Name(), k.Name(), gk.Value(), k.Value())
+		}
+		if gk.Comment != k.Comment {
+			t.Errorf("%s: [%s] %s comment = %q, want %q", user, want.Name(), k.Name(), gk.Comment, k.Comment)
+		}
+	}
+}
+
+func TestViewOwnMetadata(t *testing.T) {
+	v, err := Parse(&Config{}, []byte(viewMaster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants, err := v.grants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range grants {
+		if g.user != "dave@example.com" {
+			continue
+		}
+		cfg, err := v.view(g, false, MetadataOwn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys := cfg.Section("ACCESS").KeyStrings(); !equalStrings(keys, []string{"@ops"}) {
+			t.Errorf("ACCESS = %q, want [@ops]", keys)
+		}
+		if _, err := cfg.GetSection("GROUPS"); err == nil {
+			t.Errorf("view has GROUPS")
+		}
+	}
+}
+
+func TestCheckAdmins(t *testing.T) {
+	const vault = `[ACCESS]
+alice@example.com = *
+bob@example.com   = web
+
+[SETTINGS]
+admins = alice@example.com, bob@example.com
+
+[web]
+password = xx
+`
+	problems, err := Check(&Config{}, []byte(vault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 {
+		t.Fatalf("Check() = %v, want one problem", problems)
+	}
+	p := problems[0]
+	if want := "line 6: SETTINGS: admins: bob@example.com is not granted * in ACCESS"; !p.Fatal || p.String() != want {
+		t.Errorf("Check() = %+v, want a fatal %q", p, want)
+	}
+}
@@ -1,217 +1,650 @@
-package main
+// Package ponder implements a shared password vault stored as per-user
+// OpenPGP encrypted INI files.
+package ponder
 
 import (
 	"bytes"
-	"flag"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/go-ini/ini"
-	"github.com/proglottis/gpgme"
 )
 
-// Template for initialized files
-const (
-	TEMPLATE = `[ACCESS]
+// Template for initialized vaults
+const TEMPLATE = `[ACCESS]
 %s = *
 
 [myhost]
 username = me
 password = xx`
-	LOCATION = "./"
-)
 
-func main() {
-	var init bool
-	var edit bool
+var (
+	ErrNoKeyFile       = errors.New("unable to find matching key file")
+	ErrNoKeys          = errors.New("no keys found in keyring")
+	ErrNoAccess        = errors.New("section 'ACCESS' does not exist")
+	ErrSectionNotFound = errors.New("section not found")
+	ErrKeyNotFound     = errors.New("key not found")
+	ErrNoIdentity      = errors.New("vault was not opened with a key")
+	ErrNoMaster        = errors.New("vault has no master copy")
+	ErrNotAdmin        = errors.New("only admins can write this vault")
+	ErrPartialView     = errors.New("this copy of the vault does not hold every section; only users granted * can write it")
+)
 
-	flag.BoolVar(&init, "i", false, "Initialize a new password db")
-	flag.BoolVar(&edit, "e", false, "Edit a password db")
+// Vault is a decrypted password database.
+type Vault struct {
+	conf  *Config
+	cfg   *ini.File
+	lines map[string]map[string]int
+	key   *Key // the key the vault was decrypted with
 
-	flag.Parse()
+	rev    string // the revision the vault was decrypted at
+	base   []byte // the plaintext the vault was decrypted from
+	master bool   // whether it was decrypted from the master copy
+}
 
-	if init {
-		keys, _ := gpgme.FindKeys("", false)
-		email := keys[0].UserIDs().Email()
+// Open decrypts the vault file in conf.Dir matching one of the secret keys
+// in the keyring. A nil conf loads the default config.
+func Open(conf *Config) (*Vault, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	plain, key, err := decrypt(conf)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Parse(conf, plain.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	v.key = key
+	v.rev, v.base = revision(plain.Bytes()), plain.Bytes()
+	return v, nil
+}
 
-		editString(fmt.Sprintf(TEMPLATE, email))
+// OpenMaster decrypts the master copy of the vault in conf.Dir, which only
+// admins can read. A nil conf loads the default config.
+func OpenMaster(conf *Config) (*Vault, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	name := conf.findFile(masterName)
+	if name == "" {
+		return nil, ErrNoMaster
+	}
+	plain, err := decryptFile(conf, name)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Parse(conf, plain.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	v.rev, v.base, v.master = revision(plain.Bytes()), plain.Bytes(), true
+	return v, nil
+}
 
-	} else if edit {
-		plain, err := decrypt()
-		if err != nil {
-			panic(err)
+// OpenWritable opens the copy of the vault that changes should be made to:
+// the master copy when there is one, so that saving does not drop sections
+// the current key cannot read, and the current key's copy otherwise. It
+// fails with ErrNotAdmin if the current key can read its own copy but not
+// the master copy, and with ErrPartialView if there is no master copy and
+// its own copy does not hold every section.
+func OpenWritable(conf *Config) (*Vault, error) {
+	v, err := OpenMaster(conf)
+	if err == ErrNoMaster {
+		if v, err = Open(conf); err != nil {
+			return nil, err
 		}
-		editString(plain.String())
-	} else {
-		plain, err := decrypt()
+		w, err := v.Whoami()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		if _, err := io.Copy(os.Stdout, plain); err != nil {
-			panic(err)
+		if !w.All {
+			return nil, ErrPartialView
 		}
+		return v, nil
 	}
+	if err != nil {
+		if own, oerr := Open(conf); oerr == nil {
+			if w, werr := own.Whoami(); werr == nil && !w.Admin {
+				return nil, ErrNotAdmin
+			}
+		}
+		return nil, err
+	}
+	return v, nil
 }
 
-func editString(text string) {
-
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "vim"
+// Parse loads a vault from its plaintext INI representation. The vault is
+// saved to conf.Dir. A nil conf loads the default config.
+func Parse(conf *Config, plain []byte) (*Vault, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
 	}
+	cfg, err := ini.Load(plain)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{conf: conf, cfg: cfg, lines: keyLines(plain)}, nil
+}
 
-	tmpfile, _ := ioutil.TempFile("", "")
-
-	_, _ = tmpfile.WriteString(text)
+func defaultConfig(conf *Config) (*Config, error) {
+	if conf != nil {
+		return conf, nil
+	}
+	return LoadConfig(DefaultConfigPath())
+}
 
-	cmd := exec.Command(editor, tmpfile.Name())
+// Template returns the plaintext of a new vault granting the first secret
+// key in the keyring, or the first age identity, access to everything. A
+// nil conf loads the default config.
+func Template(conf *Config) (string, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return "", err
+	}
+	crypt, err := conf.crypter()
+	if err != nil {
+		return "", err
+	}
+	keys, err := crypt.Keys(true)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) > 0 {
+		return fmt.Sprintf(TEMPLATE, keys[0].Email()), nil
+	}
+	ids, err := conf.ageIdentities()
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", ErrNoKeys
+	}
+	user := ids[0].key.Fingerprint()
+	if strings.HasPrefix(user, "ssh-") {
+		// RSA keys may end in =, which ends an unquoted INI key.
+		user = "`" + user + "`"
+	}
+	return fmt.Sprintf(TEMPLATE, user), nil
+}
 
-	// without setting std correctly editor will not launch
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// Get returns the value of key in section.
+func (v *Vault) Get(section, key string) (string, error) {
+	sec, err := v.cfg.GetSection(section)
+	if err != nil {
+		return "", ErrSectionNotFound
+	}
+	k, err := sec.GetKey(key)
+	if err != nil {
+		return "", ErrKeyNotFound
+	}
+	return k.Value(), nil
+}
 
-	err := cmd.Start()
-	err = cmd.Wait()
+// Set stores value under key in section, creating either as needed.
+func (v *Vault) Set(section, key, value string) error {
+	sec, err := v.cfg.NewSection(section)
+	if err != nil {
+		return err
+	}
+	k, err := sec.NewKey(key, value)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	// NewKey leaves the section's key hash stale when key already exists.
+	k.SetValue(value)
+	return nil
+}
 
-	encrypt(tmpfile)
-	// close and remove temp file
-	tmpfile.Close()
-	os.Remove(tmpfile.Name())
+// Delete removes key from section, or the whole section when key is empty.
+func (v *Vault) Delete(section, key string) error {
+	sec, err := v.cfg.GetSection(section)
+	if err != nil {
+		return ErrSectionNotFound
+	}
+	if key == "" {
+		v.cfg.DeleteSection(section)
+		return nil
+	}
+	if !inSlice(key, sec.KeyStrings()) {
+		return ErrKeyNotFound
+	}
+	sec.DeleteKey(key)
+	return nil
 }
 
-func findKey(user string, keylist []*gpgme.Key) []*gpgme.Key {
-	var userKey []*gpgme.Key
-	for i := 0; i < len(keylist); i++ {
-		subkey := keylist[i].SubKeys()
-		if user == subkey.KeyID() {
-			userKey = append(userKey, keylist[i])
-		}
-		userIDs := keylist[i].UserIDs()
-		if user == userIDs.Email() {
-			userKey = append(userKey, keylist[i])
+// Sections returns the names of all sections in the vault.
+func (v *Vault) Sections() []string {
+	var names []string
+	for _, name := range v.cfg.SectionStrings() {
+		if name == ini.DEFAULT_SECTION {
+			continue
 		}
+		names = append(names, name)
 	}
-	return userKey
+	return names
 }
 
-func copy_ini(cfg *ini.File, sections []string) *ini.File {
-	if sections == nil {
-		return cfg
+// Keys returns the names of the keys in section.
+func (v *Vault) Keys(section string) ([]string, error) {
+	sec, err := v.cfg.GetSection(section)
+	if err != nil {
+		return nil, ErrSectionNotFound
 	}
+	return sec.KeyStrings(), nil
+}
 
-	newCfg := ini.Empty()
-	allSections := cfg.Sections()
-	for i := 0; i < len(allSections); i++ {
-		for j := 0; j < len(sections); j++ {
-			base := strings.Split(allSections[i].Name(), ".")
-			if allSections[i].Name() == sections[j] || base[0] == sections[j] {
-				_, err := newCfg.NewSection(allSections[i].Name())
+// WriteTo writes the plaintext INI representation of the vault to w.
+func (v *Vault) WriteTo(w io.Writer) (int64, error) {
+	return v.cfg.WriteTo(w)
+}
 
-				if err != nil {
-					panic(err)
-				}
-			}
+// Save encrypts a copy of the vault for every user in the ACCESS section,
+// and a master copy for the admins, holding the vault's write lock. It
+// fails with a ConflictError, writing nothing, if the vault was opened from
+// disk and has been saved by someone else since, and with ErrPartialView
+// if it was opened from a user's copy that does not hold every section,
+// since saving would drop the others from every file. A vault unchanged
+// since it was opened is not written again. With conf.Git set, the vault
+// files are then committed.
+func (v *Vault) Save() error {
+	return v.save(false)
+}
+
+// Rekey saves the vault like Save, but re-encrypts every file even if the
+// vault is unchanged, for users whose keys changed since it was saved.
+func (v *Vault) Rekey() error {
+	return v.save(true)
+}
+
+func (v *Vault) save(force bool) error {
+	if v.rev != "" && !v.master {
+		w, err := v.Whoami()
+		if err != nil {
+			return err
+		}
+		if !w.All {
+			return ErrPartialView
 		}
 	}
+	if !force {
+		// Files are encrypted with a new session key every time, so saving
+		// an unchanged vault would rewrite and commit every file for
+		// nothing.
+		if unchanged, err := v.unchanged(); err != nil || unchanged {
+			return err
+		}
+	}
+	grants, err := v.grants()
+	if err != nil {
+		return err
+	}
+	unlock, err := v.conf.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := v.checkRevision(); err != nil {
+		return err
+	}
+	if err := v.encrypt(grants); err != nil {
+		return err
+	}
+	if !v.conf.Git {
+		return nil
+	}
+	signer, err := v.conf.signer()
+	if err == nil {
+		err = v.commit(signer)
+	}
+	if err != nil {
+		return fmt.Errorf("the vault files were saved, but committing them failed: %v", err)
+	}
+	return nil
+}
 
-	return newCfg
+// isMeta reports whether section holds vault metadata rather than secrets.
+func isMeta(section string) bool {
+	return section == ini.DEFAULT_SECTION || section == "ACCESS" || section == "GROUPS" || section == "SETTINGS"
 }
 
-func encrypt(tmpFile *os.File) {
-	keys, _ := gpgme.FindKeys("", false)
+func inSlice(str string, s []string) bool {
+	for _, v := range s {
+		if str == v {
+			return true
+		}
+	}
+	return false
+}
 
-	cfg, err := ini.Load(tmpFile.Name())
+// copySection copies sec with its comment and keys, in order, into cfg.
+func copySection(cfg *ini.File, sec *ini.Section) error {
+	newSec, err := cfg.NewSection(sec.Name())
+	if err != nil {
+		return err
+	}
+	newSec.Comment = sec.Comment
 
+	for _, k := range sec.Keys() {
+		newKey, err := newSec.NewKey(k.Name(), k.Value())
+		if err != nil {
+			return err
+		}
+		newKey.Comment = k.Comment
+	}
+	return nil
+}
+
+func (v *Vault) encrypt(grants []grant) error {
+	admins, err := v.admins(grants)
+	if err != nil {
+		return err
+	}
+	metadata, err := v.metadata()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	access, err := cfg.GetSection("ACCESS")
+	// Resolve every recipient before writing anything, so a bad key does
+	// not leave the vault half saved.
+	recipients, adminKeys, missing, err := v.resolveRecipients(grants, admins)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		err := &MissingKeysError{Keys: missing}
+		if !v.conf.AllowMissing {
+			return err
+		}
+		v.conf.warn("%v", err)
+	}
 
+	signer, err := v.conf.signer()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	accesshash := access.KeysHash()
+	if err := v.encryptMaster(adminKeys, signer); err != nil {
+		return err
+	}
 
-	for user, sections := range accesshash {
-		key := findKey(user, keys)
+	grants, recipients, isAdmin := mergeGrants(grants, recipients, admins)
+	for i, g := range grants {
+		key := recipients[i]
+		newCfg, err := v.view(g, isAdmin[i], metadata)
+		if err != nil {
+			return err
+		}
+		buf := new(bytes.Buffer)
+		if _, err := newCfg.WriteTo(buf); err != nil {
+			return err
+		}
+
+		if err := v.conf.writeFile(keyName(key), []*Key{key}, signer, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeGrants merges the grants resolved to the same key, such as a user
+// named by both email and fingerprint or also through a group, since they
+// share a file. Grants without a key are dropped. It returns the merged
+// grants, their keys and whether each includes an admin.
+func mergeGrants(grants []grant, keys []*Key, admins map[string]bool) ([]grant, []*Key, []bool) {
+	var merged []grant
+	var mergedKeys []*Key
+	var isAdmin []bool
+	index := make(map[string]int)
+	for i, g := range grants {
+		key := keys[i]
 		if key == nil {
-			println(fmt.Sprintf("No key found for %s", user))
 			continue
 		}
-
-		var userSections []string
-		if sections != "*" {
-			userSections = strings.Split(sections, "")
+		j, ok := index[key.Fingerprint()]
+		if !ok {
+			j = len(merged)
+			index[key.Fingerprint()] = j
+			merged = append(merged, grant{user: g.user})
+			mergedKeys = append(mergedKeys, key)
+			isAdmin = append(isAdmin, false)
 		}
+		merged[j].access = append(merged[j].access, g.access...)
+		for _, entry := range g.entries {
+			if !inSlice(entry, merged[j].entries) {
+				merged[j].entries = append(merged[j].entries, entry)
+			}
+		}
+		isAdmin[j] = isAdmin[j] || admins[g.user]
+	}
+	return merged, mergedKeys, isAdmin
+}
 
-		buf := new(bytes.Buffer)
-		newCfg := copy_ini(cfg, userSections)
-		_, err := newCfg.WriteTo(buf)
-		if err != nil {
-			panic(err)
+// resolveRecipients returns the key of every grant, nil if it has none
+// usable, the keys of admins, and the recipients whose key cannot be used.
+func (v *Vault) resolveRecipients(grants []grant, admins map[string]bool) ([]*Key, []*Key, []MissingKey, error) {
+	crypt, err := v.conf.crypter()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if v.conf.backend() == "gpgme" {
+		if err := v.conf.syncKeys(); err != nil {
+			return nil, nil, nil, err
 		}
+	}
+	keys, err := crypt.Keys(false)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		f, err := os.Create(fmt.Sprintf("test-%s.gpg", key[0].SubKeys().KeyID()))
+	var missing []MissingKey
+	recipients := make([]*Key, len(grants))
+	for i, g := range grants {
+		key, err := resolveKey(g.user, keys, v.conf.MinValidity)
 		if err != nil {
-			panic(err)
+			missing = append(missing, MissingKey{User: g.user, Reason: err.Error()})
+			continue
 		}
+		recipients[i] = key
+	}
+	adminKeys, adminMissing := resolveAdmins(admins, keys, v.conf.MinValidity)
+	return recipients, adminKeys, append(missing, adminMissing...), nil
+}
 
-		cipher, err := gpgme.NewDataWriter(f)
+// resolveAdmins returns the keys of admins, in a stable order and without
+// duplicates, and the admins whose key could not be used.
+func resolveAdmins(admins map[string]bool, keys []*Key, min Validity) ([]*Key, []MissingKey) {
+	var users []string
+	for user := range admins {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var recipients []*Key
+	var missing []MissingKey
+	seen := make(map[string]bool)
+	for _, user := range users {
+		if isAgeRecipient(user) {
+			// The master copy is OpenPGP encrypted; age admins only
+			// receive the full metadata in their own copy.
+			continue
+		}
+		key, err := resolveKey(user, keys, min)
 		if err != nil {
-			panic(err)
+			missing = append(missing, MissingKey{User: user, Reason: "admin: " + err.Error()})
+			continue
+		}
+		if id := key.Fingerprint(); !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, key)
 		}
+	}
+	return recipients, missing
+}
 
-		ctx, err := gpgme.New()
-		if err != nil {
-			panic(err)
+// encryptMaster writes the full vault encrypted to every admin key.
+func (v *Vault) encryptMaster(recipients []*Key, signer *Key) error {
+	if len(recipients) == 0 {
+		// A master left from an earlier save would be what the next edit
+		// starts from, silently reverting this one.
+		v.conf.warn("no admin keys found, removing the master copy")
+		for _, ext := range []string{binaryExt, armorExt} {
+			if err := os.Remove(v.conf.path(masterName + ext)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
 		}
+		return nil
+	}
 
-		plain, err := gpgme.NewDataReader(buf)
+	buf := new(bytes.Buffer)
+	if _, err := v.cfg.WriteTo(buf); err != nil {
+		return err
+	}
+	return v.conf.writeFile(masterName, recipients, signer, buf)
+}
 
-		if err := ctx.Encrypt(key, 0, plain, cipher); err != nil {
-			panic(err)
-		}
+// writeFile writes the vault file name, with the extension for c.Armor,
+// and removes any copy of it in the other format.
+func (c *Config) writeFile(name string, recipients []*Key, signer *Key, r io.Reader) error {
+	if recipients[0].isAge() {
+		return c.encryptFile(c.path(name+ageExt), recipients, signer, r)
+	}
+	if err := c.encryptFile(c.path(name+c.ext()), recipients, signer, r); err != nil {
+		return err
+	}
+	other := c.path(name + binaryExt)
+	if !c.Armor {
+		other = c.path(name + armorExt)
+	}
+	if err := os.Remove(other); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// encryptFile writes the contents of r to name, signed by signer and
+// encrypted to recipients, with age if they are age keys, ASCII armored if
+// c.Armor is set. The file is written under a temporary name and renamed
+// into place, so readers never see it half written.
+func (c *Config) encryptFile(name string, recipients []*Key, signer *Key, r io.Reader) error {
+	crypt, err := c.crypter()
+	if err != nil {
+		return err
+	}
+	signed, err := crypt.Sign(r, signer)
+	if err != nil {
+		return err
+	}
 
-		f.Close()
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
 
+	if recipients[0].isAge() {
+		err = ageEncrypt(f, bytes.NewReader(signed), recipients, c.Armor)
+	} else {
+		err = crypt.Encrypt(f, bytes.NewReader(signed), recipients, c.Armor)
+	}
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
 	}
+	if err := f.Chmod(0644); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
 }
 
-func decrypt() (*bytes.Buffer, error) {
+// masterName is the name, without extension, of the vault file encrypted
+// for the admins.
+const masterName = "master"
+
+// decrypt decrypts the vault file of the first secret key in the keyring,
+// or age identity, that has one.
+func decrypt(conf *Config) (*bytes.Buffer, *Key, error) {
 	var filename string
-	keys, _ := gpgme.FindKeys("", false)
+	var key *Key
+	crypt, err := conf.crypter()
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, err := crypt.Keys(true)
+	if err != nil {
+		return nil, nil, err
+	}
 	for i := 0; i < len(keys); i++ {
-		gpgKey := fmt.Sprintf("%s.gpg", keys[i].SubKeys().KeyID())
-		filePath, _ := filepath.Abs(gpgKey)
-		if _, err := os.Stat(filePath); err == nil {
-			filename = filePath
+		if name := conf.findFile(keyName(keys[i])); name != "" {
+			filename, _ = filepath.Abs(name)
+			key = keys[i]
 			break
 		}
 	}
 
+	var identity *ageIdentity
 	if filename == "" {
-		log.Fatal("Unable to find matching key file")
+		ids, err := conf.ageIdentities()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := range ids {
+			if name := conf.findFile(keyName(ids[i].key)); name != "" {
+				filename, _ = filepath.Abs(name)
+				identity, key = &ids[i], ids[i].key
+				break
+			}
+		}
+	}
+
+	if filename == "" {
+		return nil, nil, ErrNoKeyFile
+	}
+
+	var buf *bytes.Buffer
+	if identity != nil {
+		buf, err = decryptAgeFile(conf, filename, identity)
+	} else {
+		buf, err = decryptFile(conf, filename)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+	return buf, key, nil
+}
 
-	f, err := os.Open(filename)
-	plain, err := gpgme.Decrypt(f)
-	defer plain.Close()
+// decryptFile decrypts name and verifies its signature.
+func decryptFile(conf *Config, name string) (*bytes.Buffer, error) {
+	crypt, err := conf.crypter()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	buf := new(bytes.Buffer)
-	buf.ReadFrom(plain)
-	return buf, err
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msg, err := crypt.Decrypt(f)
+	if err != nil {
+		return nil, err
+	}
+	return conf.verify(name, msg)
 }
@@ -0,0 +1,126 @@
+package ponder
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const mergeVault = `[ACCESS]
+alice@example.com                        = web
+AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB = db
+@ops                                     = billing
+bob@example.com                          = web
+
+[GROUPS]
+ops = alice@example.com
+
+[web]
+password = w
+
+[db]
+password = d
+
+[billing]
+card = b
+`
+
+func TestMergeGrants(t *testing.T) {
+	v, err := Parse(&Config{}, []byte(mergeVault))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grants, err := v.grants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &Key{SubKeys: []SubKey{{Fingerprint: "AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB"}}}
+	bob := &Key{SubKeys: []SubKey{{Fingerprint: "0E06D6CDB03A6D1EBD86BA4DFFF2B806FCC32F7B"}}}
+	keys := make([]*Key, len(grants))
+	for i, g := range grants {
+		switch g.user {
+		case "alice@example.com", "AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB":
+			keys[i] = alice
+		case "bob@example.com":
+			keys[i] = bob
+		}
+	}
+	admins := map[string]bool{"AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB": true}
+
+	merged, mergedKeys, isAdmin := mergeGrants(grants, keys, admins)
+	if len(merged) != 2 {
+		t.Fatalf("got %d grants, want 2", len(merged))
+	}
+	if mergedKeys[0] != alice || mergedKeys[1] != bob {
+		t.Errorf("keys are not alice's then bob's")
+	}
+	if !isAdmin[0] || isAdmin[1] {
+		t.Errorf("isAdmin = %v, want [true false]", isAdmin)
+	}
+	for _, section := range []string{"web", "db", "billing"} {
+		if !merged[0].access.Allows(section) {
+			t.Errorf("alice's merged grant does not allow %s", section)
+		}
+	}
+	if want := []string{"alice@example.com", "@ops", "AE1D8D63DFEFB677E3896BE47E969CEAA8E9B1FB"}; !equalStrings(merged[0].entries, want) {
+		t.Errorf("alice's entries = %q, want %q", merged[0].entries, want)
+	}
+	if merged[1].access.Allows("db") {
+		t.Errorf("bob's grant allows db")
+	}
+}
+
+func TestTemplateSSHKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ponder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A 3072 bit key, the ssh-keygen default, ends in = when encoded.
+	priv, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "id_rsa")
+	if err := ioutil.WriteFile(name, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{crypt: &openpgpCrypter{}, Identities: []string{name}}
+	text, err := Template(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Parse(conf, []byte(text))
+	if err != nil {
+		t.Fatalf("parsing the template: %v\n%s", err, text)
+	}
+	grants, err := v.grants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sshKeyString(pub)
+	if !strings.HasSuffix(want, "=") {
+		t.Fatalf("public key %s does not end in =", want)
+	}
+	if len(grants) != 1 || grants[0].user != want || !grants[0].access.All() {
+		t.Errorf("template grants %+v, want * for %s", grants, want)
+	}
+}
@@ -0,0 +1,169 @@
+package ponder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// ConflictError reports that the vault was saved by someone else since it
+// was opened, so saving would overwrite their changes.
+type ConflictError struct {
+	Base   *Vault // the vault as it was opened
+	Theirs *Vault // the vault now on disk
+}
+
+func (e *ConflictError) Error() string {
+	return "the vault was saved by someone else since it was opened"
+}
+
+// revision returns the revision of a vault with plaintext plain.
+func revision(plain []byte) string {
+	sum := sha256.Sum256(plain)
+	return hex.EncodeToString(sum[:])
+}
+
+// Revision returns the SHA-256 of the plaintext the vault was decrypted
+// from, or "" for a vault that was not read from disk.
+func (v *Vault) Revision() string {
+	return v.rev
+}
+
+// unchanged reports whether v holds the plaintext it was opened from.
+func (v *Vault) unchanged() (bool, error) {
+	if v.rev == "" {
+		return false, nil
+	}
+	buf := new(bytes.Buffer)
+	if _, err := v.cfg.WriteTo(buf); err != nil {
+		return false, err
+	}
+	return revision(buf.Bytes()) == v.rev, nil
+}
+
+// Edit returns the vault parsed from plain, the edited text of v. Like v,
+// saving it fails with a ConflictError if the vault changed on disk since
+// v was opened.
+func (v *Vault) Edit(plain []byte) (*Vault, error) {
+	e, err := Parse(v.conf, plain)
+	if err != nil {
+		return nil, err
+	}
+	e.key, e.rev, e.base, e.master = v.key, v.rev, v.base, v.master
+	return e, nil
+}
+
+// checkRevision returns a ConflictError if the copy of the vault v was
+// opened from changed since.
+func (v *Vault) checkRevision() error {
+	if v.rev == "" {
+		return nil
+	}
+	open := Open
+	if v.master {
+		open = OpenMaster
+	}
+	theirs, err := open(v.conf)
+	if err != nil {
+		return err
+	}
+	if theirs.rev == v.rev {
+		return nil
+	}
+	base, err := Parse(v.conf, v.base)
+	if err != nil {
+		return err
+	}
+	return &ConflictError{Base: base, Theirs: theirs}
+}
+
+// Merge merges the changes made to base in ours and theirs, section by
+// section. A section changed in only one of them is taken from it; a
+// section changed differently in both is taken from ours, with theirs
+// in a comment, and its name is returned. The merged vault is an edit of
+// theirs.
+func Merge(base, ours, theirs *Vault) (*Vault, []string, error) {
+	merged := ini.Empty()
+	var conflicts []string
+
+	names := theirs.cfg.SectionStrings()
+	for _, name := range ours.cfg.SectionStrings() {
+		if !inSlice(name, names) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		b, o, t := sectionText(base, name), sectionText(ours, name), sectionText(theirs, name)
+		from := ours
+		switch {
+		case o == t, t == b:
+		case o == b:
+			from = theirs
+		default:
+			conflicts = append(conflicts, name)
+			if o == "" {
+				from = theirs
+			}
+		}
+		if sectionText(from, name) == "" {
+			// Removed.
+			continue
+		}
+		if err := copySection(merged, from.cfg.Section(name)); err != nil {
+			return nil, nil, err
+		}
+		if inSlice(name, conflicts) {
+			sec := merged.Section(name)
+			sec.Comment = conflictComment(t, sec.Comment)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := merged.WriteTo(buf); err != nil {
+		return nil, nil, err
+	}
+	v, err := theirs.Edit(buf.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, conflicts, nil
+}
+
+// sectionText returns section name in v as text, without comments, or ""
+// if v has no such section.
+func sectionText(v *Vault, name string) string {
+	sec, err := v.cfg.GetSection(name)
+	if err != nil {
+		return ""
+	}
+	lines := []string{"[" + name + "]"}
+	for _, k := range sec.Keys() {
+		lines = append(lines, fmt.Sprintf("%s = %s", k.Name(), k.Value()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// conflictMarker starts the comment holding the other version of a
+// conflicting section. Check refuses to save a vault still holding one.
+const conflictMarker = "; CONFLICT:"
+
+// conflictComment returns comment preceded by a note holding theirs, the
+// other version of a conflicting section.
+func conflictComment(theirs, comment string) string {
+	lines := []string{conflictMarker + " this section was also changed on disk. Their version:"}
+	if theirs == "" {
+		lines = append(lines, ";   (removed)")
+	} else {
+		for _, line := range strings.Split(theirs, "\n")[1:] {
+			lines = append(lines, ";   "+line)
+		}
+	}
+	if comment != "" {
+		lines = append(lines, comment)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,145 @@
+package ponder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-ini/ini"
+)
+
+const mergeBase = `top = 1
+
+[ACCESS]
+alice@example.com = *
+
+[web]
+password = a
+
+[db]
+password = b
+`
+
+func TestMergeDefault(t *testing.T) {
+	tests := []struct {
+		ours, theirs string
+		want         string // the merged value of top
+		conflicts    []string
+	}{
+		{
+			// Ours changed DEFAULT, theirs another section.
+			ours:   "top = 2\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\n[db]\npassword = b\n",
+			theirs: "top = 1\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\n[db]\npassword = c\n",
+			want:   "2",
+		},
+		{
+			// Theirs changed DEFAULT, ours another section.
+			ours:   "top = 1\n[ACCESS]\nalice@example.com = *\n[web]\npassword = z\n[db]\npassword = b\n",
+			theirs: "top = 3\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\n[db]\npassword = b\n",
+			want:   "3",
+		},
+		{
+			// Both changed DEFAULT: ours wins, reported as a conflict.
+			ours:      "top = 2\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\n[db]\npassword = b\n",
+			theirs:    "top = 3\n[ACCESS]\nalice@example.com = *\n[web]\npassword = a\n[db]\npassword = b\n",
+			want:      "2",
+			conflicts: []string{ini.DEFAULT_SECTION},
+		},
+	}
+	for i, tt := range tests {
+		base, err := Parse(&Config{}, []byte(mergeBase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ours, err := Parse(&Config{}, []byte(tt.ours))
+		if err != nil {
+			t.Fatal(err)
+		}
+		theirs, err := Parse(&Config{}, []byte(tt.theirs))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		merged, conflicts, err := Merge(base, ours, theirs)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if !equalStrings(conflicts, tt.conflicts) {
+			t.Errorf("%d: conflicts = %q, want %q", i, conflicts, tt.conflicts)
+		}
+		if got := merged.cfg.Section(ini.DEFAULT_SECTION).Key("top").String(); got != tt.want {
+			t.Errorf("%d: top = %q, want %q", i, got, tt.want)
+		}
+		for _, name := range []string{"ACCESS", "web", "db"} {
+			if _, err := merged.cfg.GetSection(name); err != nil {
+				t.Errorf("%d: merged vault lost section %s", i, name)
+			}
+		}
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	base, err := Parse(&Config{}, []byte(mergeBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, err := Parse(&Config{}, []byte("top = 1\n[ACCESS]\nalice@example.com = *\n[web]\npassword = ours\n[db]\npassword = b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := Parse(&Config{}, []byte("top = 1\n[ACCESS]\nalice@example.com = *\n[web]\npassword = theirs\n[db]\npassword = b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, _, err := Merge(base, ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if _, err := merged.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	if !strings.Contains(text, "password = theirs") {
+		t.Fatalf("merged vault does not hold their version:\n%s", text)
+	}
+
+	problems, err := Check(&Config{AllowMissing: true}, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || !problems[0].Fatal {
+		t.Fatalf("Check() = %v, want one fatal problem", problems)
+	}
+	if line := strings.Split(text, "\n")[problems[0].Line-1]; !strings.HasPrefix(line, conflictMarker) {
+		t.Errorf("Check() reported line %d, %q, want the CONFLICT comment", problems[0].Line, line)
+	}
+
+	resolved := strings.Replace(text, conflictMarker, "; resolved:", 1)
+	if problems, err := Check(&Config{AllowMissing: true}, []byte(resolved)); err != nil || len(problems) != 0 {
+		t.Errorf("Check() of the resolved vault = %v, %v, want no problems", problems, err)
+	}
+}
+
+func TestUnchanged(t *testing.T) {
+	v, err := Parse(&Config{}, []byte(mergeBase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged, err := v.unchanged(); err != nil || unchanged {
+		t.Errorf("unchanged() of a vault not read from disk = %v, %v, want false", unchanged, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := v.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	v.rev = revision(buf.Bytes())
+	if unchanged, err := v.unchanged(); err != nil || !unchanged {
+		t.Errorf("unchanged() = %v, %v, want true", unchanged, err)
+	}
+	v.cfg.Section("web").Key("password").SetValue("z")
+	if unchanged, err := v.unchanged(); err != nil || unchanged {
+		t.Errorf("unchanged() after a change = %v, %v, want false", unchanged, err)
+	}
+}
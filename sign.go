@@ -0,0 +1,149 @@
+package ponder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Verify modes.
+const (
+	VerifyWarn    = "warn"    // warn through Config.Warn and use the file anyway
+	VerifyRequire = "require" // refuse to use the file
+)
+
+var ErrNoSigner = errors.New("no secret key able to sign found")
+
+// UntrustedError reports a vault file that is unsigned or not signed by a
+// trusted writer.
+type UntrustedError struct {
+	File   string
+	Reason string
+}
+
+func (e *UntrustedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.File, e.Reason)
+}
+
+// signer returns the secret key vault files are signed with.
+func (c *Config) signer() (*Key, error) {
+	crypt, err := c.crypter()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := crypt.Keys(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if c.Signer != "" && findKey(c.Signer, []*Key{key}) == nil {
+			continue
+		}
+		if key.CanSign && !key.Revoked && !key.Expired && !key.Disabled && !key.Invalid {
+			return key, nil
+		}
+	}
+	if c.Signer != "" {
+		return nil, fmt.Errorf("no secret key able to sign found for %s", c.Signer)
+	}
+	return nil, ErrNoSigner
+}
+
+// verify checks the signed message msg decrypted from the vault file name
+// and returns the message it contains. Files that are unsigned or not
+// signed by a trusted writer are refused or warned about according to
+// c.Verify.
+func (c *Config) verify(name string, msg []byte) (*bytes.Buffer, error) {
+	crypt, err := c.crypter()
+	if err != nil {
+		return nil, err
+	}
+
+	plain, sigs, err := crypt.Verify(msg)
+	if err != nil {
+		// Files written before signing was introduced hold the plain INI.
+		return bytes.NewBuffer(msg), c.untrusted(name, "file is not signed")
+	}
+
+	reason, err := c.checkSignatures(sigs)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return bytes.NewBuffer(plain), c.untrusted(name, reason)
+	}
+	return bytes.NewBuffer(plain), nil
+}
+
+// checkSignatures returns why none of sigs is a good signature by a
+// trusted writer, or "" if one is.
+func (c *Config) checkSignatures(sigs []Signature) (string, error) {
+	if len(sigs) == 0 {
+		return "file is not signed", nil
+	}
+
+	trusted, err := c.trustedFingerprints()
+	if err != nil {
+		return "", err
+	}
+
+	var reasons []string
+	for _, sig := range sigs {
+		switch {
+		case sig.Err != nil:
+			reasons = append(reasons, fmt.Sprintf("bad signature by %s: %v", sig.Fingerprint, sig.Err))
+		case !trusted[normFingerprint(sig.Fingerprint)]:
+			reasons = append(reasons, fmt.Sprintf("signed by %s, who is not a trusted writer", sig.Fingerprint))
+		default:
+			return "", nil
+		}
+	}
+	return strings.Join(reasons, ", "), nil
+}
+
+// trustedFingerprints returns the fingerprints of every key and subkey of
+// the trusted writers and of the user's own secret keys. Writers are only
+// matched by primary key fingerprint, never by email.
+func (c *Config) trustedFingerprints() (map[string]bool, error) {
+	crypt, err := c.crypter()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := crypt.Keys(false)
+	if err != nil {
+		return nil, err
+	}
+	own, err := crypt.Keys(true)
+	if err != nil {
+		return nil, err
+	}
+	trusted := make(map[string]bool)
+	addKey := func(key *Key) {
+		for _, sk := range key.SubKeys {
+			trusted[normFingerprint(sk.Fingerprint)] = true
+		}
+	}
+	for _, key := range own {
+		addKey(key)
+	}
+	for _, writer := range c.TrustedWriters {
+		for _, key := range keys {
+			if key.Fingerprint() == normFingerprint(writer) {
+				addKey(key)
+			}
+		}
+	}
+	return trusted, nil
+}
+
+// untrusted returns an UntrustedError in VerifyRequire mode, and warns and
+// returns nil otherwise.
+func (c *Config) untrusted(name, reason string) error {
+	err := &UntrustedError{File: name, Reason: reason}
+	if c.Verify == VerifyRequire {
+		return err
+	}
+	c.warn("%v; its contents may have been planted by anyone with write access to the vault", err)
+	return nil
+}
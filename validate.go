@@ -0,0 +1,125 @@
+package ponder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Problem is something wrong with the edited text of a vault.
+type Problem struct {
+	Line int // 1-based line in the edited text, 0 if unknown
+	Msg  string
+
+	// Fatal is set when the vault cannot be saved at all, rather than
+	// saved with a section or recipient left out.
+	Fatal bool
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Msg)
+	}
+	return p.Msg
+}
+
+// Check returns the problems with plain, the edited text of a vault:
+// syntax errors, a missing ACCESS section, invalid ACCESS entries, ACCESS
+// terms naming sections that do not exist, unresolved merge conflicts and,
+// unless conf.AllowMissing is set, recipients without a usable key. A nil
+// conf loads the default config.
+func Check(conf *Config, plain []byte) ([]Problem, error) {
+	conf, err := defaultConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Parse(conf, plain)
+	if err != nil {
+		return []Problem{{Msg: strings.TrimSpace(err.Error()), Fatal: true}}, nil
+	}
+	sec, err := v.cfg.GetSection("ACCESS")
+	if err != nil {
+		return []Problem{{Msg: ErrNoAccess.Error(), Fatal: true}}, nil
+	}
+
+	problems := conflicts(plain)
+	fatal := false
+	for _, k := range sec.Keys() {
+		line := v.lines["ACCESS"][k.Name()]
+		if _, err := ParseAccess(k.Value()); err != nil {
+			aerr := err.(*AccessError)
+			aerr.User = k.Name()
+			problems = append(problems, Problem{Line: line, Msg: aerr.Error(), Fatal: true})
+			fatal = true
+			continue
+		}
+		if isGroup(k.Name()) {
+			if _, err := v.members(k.Name()); err != nil {
+				problems = append(problems, Problem{Line: line, Msg: fmt.Sprintf("ACCESS: %s: %v", k.Name(), err), Fatal: true})
+				fatal = true
+				continue
+			}
+		}
+		for _, term := range splitList(k.Value()) {
+			if pattern := strings.TrimPrefix(term, "!"); pattern != "*" && !v.hasSection(pattern) {
+				problems = append(problems, Problem{Line: line, Msg: fmt.Sprintf("ACCESS: %s: no section matches %q", k.Name(), term)})
+			}
+		}
+	}
+	if fatal {
+		return problems, nil
+	}
+
+	grants, err := v.grants()
+	if err != nil {
+		return append(problems, Problem{Msg: err.Error(), Fatal: true}), nil
+	}
+	admins, err := v.admins(grants)
+	if err != nil {
+		return append(problems, Problem{Line: v.lines["SETTINGS"]["admins"], Msg: err.Error(), Fatal: true}), nil
+	}
+	if _, err := v.metadata(); err != nil {
+		return append(problems, Problem{Msg: err.Error(), Fatal: true}), nil
+	}
+	if v.conf.AllowMissing {
+		return problems, nil
+	}
+	_, _, missing, err := v.resolveRecipients(grants, admins)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range missing {
+		problems = append(problems, Problem{
+			Line: v.lines["ACCESS"][m.User],
+			Msg:  fmt.Sprintf("no usable key for %s: %s", m.User, m.Reason),
+		})
+	}
+	return problems, nil
+}
+
+// conflicts returns a fatal problem for every CONFLICT comment left by a
+// merge in plain: it holds the other writer's version of a section, which
+// would otherwise be copied to everyone who can read that section.
+func conflicts(plain []byte) []Problem {
+	var problems []Problem
+	for i, line := range strings.Split(string(plain), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), conflictMarker) {
+			problems = append(problems, Problem{
+				Line:  i + 1,
+				Msg:   "unresolved merge conflict: resolve the section and remove the CONFLICT comment",
+				Fatal: true,
+			})
+		}
+	}
+	return problems
+}
+
+// hasSection reports whether a section other than the metadata sections
+// matches pattern.
+func (v *Vault) hasSection(pattern string) bool {
+	for _, name := range v.cfg.SectionStrings() {
+		if !isMeta(name) && matchSection(pattern, name) {
+			return true
+		}
+	}
+	return false
+}